@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/Inspirate789/grpc-template/internal/pkg/app"
+	"github.com/Inspirate789/grpc-template/internal/pkg/dump"
+	"github.com/Inspirate789/grpc-template/pkg/sqlxutils"
+)
+
+const (
+	exitCodeFailure = 1
+	exitCodeUsage   = 2
+)
+
+func usageError(message string) {
+	fmt.Fprintln(os.Stderr, message)
+	os.Exit(exitCodeUsage)
+}
+
+func logStats(logger *slog.Logger, message string, stats dump.Stats) {
+	logger.Info(message,
+		slog.Uint64("users", stats[dump.TypeUser]),
+		slog.Uint64("events", stats[dump.TypeEvent]),
+		slog.Uint64("memberships", stats[dump.TypeMembership]),
+		slog.Uint64("occurrences", stats[dump.TypeOccurrence]),
+	)
+}
+
+// exportDump writes all users, events, memberships and changed occurrences to stdout or a file.
+// Logs go to stderr, so they don't mix with the records.
+func exportDump(args []string) {
+	var (
+		options      commonOptions
+		format, path string
+	)
+
+	flags := newStartupFlagSet("export", &options)
+	flags.StringVar(&format, "format", string(dump.FormatJSONL), "Output format: jsonl or csv")
+	flags.StringVarP(&path, "output", "o", "-", "Output file path, - for stdout")
+	_ = flags.Parse(args)
+
+	dumpFormat, err := dump.ParseFormat(format)
+	if err != nil {
+		usageError(err.Error())
+	}
+
+	config, err := app.ReadLocalConfig(options.configPath)
+	if err != nil {
+		panic(err)
+	}
+
+	logger := newLogger(os.Stderr, config)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+
+	db := connectDB(config, options, logger)
+	stats, err := writeDump(ctx, sqlxutils.NewDB(db), path, dumpFormat)
+
+	closeDB(db)
+	cancel()
+
+	if err != nil {
+		logger.Error("export failed", slog.String("error", err.Error()))
+		os.Exit(exitCodeFailure)
+	}
+
+	logStats(logger, "export finished", stats)
+}
+
+// importDump reads records exported by exportDump from a file or stdin and inserts the missing ones.
+func importDump(args []string) {
+	var (
+		options importOptions
+		common  commonOptions
+	)
+
+	flags := newStartupFlagSet("import", &common)
+	flags.StringVar(&options.format, "format", "", "Input format: jsonl or csv; inferred from the file extension by default")
+	flags.IntVar(&options.BatchSize, "batch-size", dump.DefaultBatchSize, "Number of records imported in one transaction")
+	flags.Uint64Var(&options.Skip, "skip", 0, "Number of leading records to skip, e.g. the ones committed before a failure")
+	flags.BoolVar(&options.DryRun, "dry-run", false, "Only read and validate the records")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		usageError("usage: app import [flags] FILE, - for stdin")
+	}
+
+	path := flags.Arg(0)
+
+	dumpFormat, err := options.dumpFormat(path)
+	if err != nil {
+		usageError(err.Error())
+	}
+
+	config, err := app.ReadLocalConfig(common.configPath)
+	if err != nil {
+		panic(err)
+	}
+
+	logger := newLogger(os.Stderr, config)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+
+	db := connectDB(config, common, logger)
+	stats, err := readDump(ctx, sqlxutils.NewDB(db), path, dumpFormat, options.ImportOptions, logger)
+
+	closeDB(db)
+	cancel()
+
+	if err != nil {
+		logger.Error("import failed", slog.String("error", err.Error()))
+		os.Exit(exitCodeFailure)
+	}
+
+	if options.DryRun {
+		logStats(logger, "dry run finished, valid records", stats)
+	} else {
+		logStats(logger, "import finished, inserted records", stats)
+	}
+}
+
+type importOptions struct {
+	dump.ImportOptions
+	format string
+}
+
+func (o importOptions) dumpFormat(path string) (dump.Format, error) {
+	if o.format != "" {
+		return dump.ParseFormat(o.format)
+	}
+
+	extension := strings.TrimPrefix(filepath.Ext(path), ".")
+	if extension == "" {
+		return "", fmt.Errorf("can't infer the format of %q, set --format", path)
+	}
+
+	return dump.ParseFormat(extension)
+}
+
+func writeDump(ctx context.Context, db *sqlxutils.DB, path string, format dump.Format) (stats dump.Stats, err error) {
+	if path == "-" {
+		return dump.Export(ctx, db, dump.NewWriter(os.Stdout, format))
+	}
+
+	output, err := os.Create(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err = errors.Join(err, output.Close())
+	}()
+
+	return dump.Export(ctx, db, dump.NewWriter(output, format))
+}
+
+func readDump(
+	ctx context.Context,
+	db *sqlxutils.DB,
+	path string,
+	format dump.Format,
+	options dump.ImportOptions,
+	logger *slog.Logger,
+) (stats dump.Stats, err error) {
+	var input io.Reader = os.Stdin
+
+	if path != "-" {
+		var file *os.File
+
+		file, err = os.Open(filepath.Clean(path))
+		if err != nil {
+			return nil, err
+		}
+
+		defer func() {
+			err = errors.Join(err, file.Close())
+		}()
+
+		input = file
+	}
+
+	return dump.Import(ctx, db, dump.NewReader(input, format), options, logger)
+}
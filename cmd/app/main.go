@@ -3,9 +3,12 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -13,22 +16,30 @@ import (
 	eventRepository "github.com/Inspirate789/grpc-template/internal/event/repository"
 	eventUsecase "github.com/Inspirate789/grpc-template/internal/event/usecase"
 	"github.com/Inspirate789/grpc-template/internal/pkg/app"
+	"github.com/Inspirate789/grpc-template/internal/pkg/auth"
+	"github.com/Inspirate789/grpc-template/internal/pkg/idempotency"
+	"github.com/Inspirate789/grpc-template/internal/pkg/tracing"
+	"github.com/Inspirate789/grpc-template/internal/pkg/validation"
 	userDelivery "github.com/Inspirate789/grpc-template/internal/user/delivery"
 	userRepository "github.com/Inspirate789/grpc-template/internal/user/repository"
 	userUsecase "github.com/Inspirate789/grpc-template/internal/user/usecase"
+	embeddedMigrations "github.com/Inspirate789/grpc-template/migrations"
 	"github.com/Inspirate789/grpc-template/pkg/migrations"
-	"github.com/golang-migrate/migrate/v4/database/sqlite3"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/Inspirate789/grpc-template/pkg/sqlxutils"
+	"github.com/gofiber/fiber/v2"
 	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
 	"github.com/lmittmann/tint"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/spf13/pflag"
 	"golang.org/x/sync/errgroup"
 )
 
-func startApp(webApp *app.WebApp, grpcApp *app.GrpcApp, config app.Config, logger *slog.Logger) {
+func startApp(webApp *app.WebApp, grpcApp *app.GrpcApp, purger *app.Purger, config app.Config, logger *slog.Logger) {
 	logger.Debug(fmt.Sprintf("app starts with configuration: %+v", config))
 
+	go purger.Start()
+
 	go func() {
 		err := webApp.Start()
 		if err != nil {
@@ -44,7 +55,7 @@ func startApp(webApp *app.WebApp, grpcApp *app.GrpcApp, config app.Config, logge
 	}()
 }
 
-func shutdownApp(webApp *app.WebApp, grpcApp *app.GrpcApp, logger *slog.Logger) {
+func shutdownApp(webApp *app.WebApp, grpcApp *app.GrpcApp, purger *app.Purger, logger *slog.Logger) {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
@@ -69,12 +80,30 @@ func shutdownApp(webApp *app.WebApp, grpcApp *app.GrpcApp, logger *slog.Logger)
 
 	eg.Go(func() error {
 		logger.Debug("shutdown grpc app ...")
-		grpcApp.Shutdown()
+
+		err := grpcApp.Shutdown(ctx)
+		if err != nil {
+			return err
+		}
+
 		logger.Debug("grpc app exited")
 
 		return nil
 	})
 
+	eg.Go(func() error {
+		logger.Debug("shutdown purger ...")
+
+		err := purger.Shutdown(ctx)
+		if err != nil {
+			return err
+		}
+
+		logger.Debug("purger exited")
+
+		return nil
+	})
+
 	err := eg.Wait()
 	if err != nil {
 		panic(err)
@@ -83,47 +112,193 @@ func shutdownApp(webApp *app.WebApp, grpcApp *app.GrpcApp, logger *slog.Logger)
 	cancel()
 }
 
+type commonOptions struct {
+	configPath     string
+	migrationsPath string
+	noMigrate      bool
+}
+
+func newFlagSet(name string, options *commonOptions) *pflag.FlagSet {
+	flags := pflag.NewFlagSet(name, pflag.ExitOnError)
+	flags.StringVarP(&options.configPath, "config", "c", "configs/app.yaml", "Config file path")
+	flags.StringVarP(&options.migrationsPath, "migrations", "m", "",
+		"Migrations directory path; the migrations embedded into the binary are used by default")
+
+	return flags
+}
+
+// newStartupFlagSet adds the flags of the commands that migrate the database before they start.
+func newStartupFlagSet(name string, options *commonOptions) *pflag.FlagSet {
+	flags := newFlagSet(name, options)
+	flags.BoolVar(&options.noMigrate, "no-migrate", false,
+		"Don't apply migrations, only check that the database isn't dirty; for migrations run as a separate job")
+
+	return flags
+}
+
+func newLogger(w io.Writer, config app.Config) *slog.Logger {
+	return slog.New(tracing.NewLogHandler(tint.NewHandler(w, &tint.Options{Level: slog.Level(config.Logging.Level)})))
+}
+
+func openDB(config app.Config) *sqlx.DB {
+	db, err := sqlx.Connect(config.DB.DriverName, config.DB.ConnectionString)
+	if err != nil {
+		panic(err)
+	}
+
+	return db
+}
+
+// migrationsFS returns the migrations of the driver from the directory set by --migrations or from the binary.
+func migrationsFS(options commonOptions, driverName string) fs.FS {
+	var fsys fs.FS = embeddedMigrations.FS
+	if options.migrationsPath != "" {
+		fsys = os.DirFS(options.migrationsPath)
+	}
+
+	driverFS, err := fs.Sub(fsys, driverName)
+	if err != nil {
+		panic(err)
+	}
+
+	return driverFS
+}
+
+// connectDB opens the configured database and applies the migrations unless they are disabled.
+func connectDB(config app.Config, options commonOptions, logger *slog.Logger) *sqlx.DB {
+	db := openDB(config)
+	driverMigrations := migrationsFS(options, config.DB.DriverName)
+
+	migrate := migrations.Do
+	if options.noMigrate {
+		migrate = migrations.Check
+	}
+
+	err := migrate(context.Background(), config.DB.DriverName, driverMigrations, db.DB, config.Migrations, logger)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return db
+}
+
+func closeDB(db *sqlx.DB) {
+	err := db.Close()
+	if err != nil {
+		panic(err)
+	}
+}
+
 func main() {
-	var configPath, migrationsPath string
-	pflag.StringVarP(&configPath, "config", "c", "configs/app.yaml", "Config file path")
-	pflag.StringVarP(&migrationsPath, "migrations", "m", "migrations", "Migrations directory path")
-	pflag.Parse()
+	command, args := "serve", os.Args[1:]
+	if len(args) != 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+		serve(args)
+	case "export":
+		exportDump(args)
+	case "import":
+		importDump(args)
+	case "seed":
+		seedCommand(args)
+	case "migrate":
+		migrateCommand(args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q, expected serve, export, import, seed or migrate\n", command)
+		os.Exit(exitCodeUsage)
+	}
+}
+
+func serve(args []string) {
+	var options commonOptions
 
-	config, err := app.ReadLocalConfig(configPath)
+	flags := newStartupFlagSet("serve", &options)
+	_ = flags.Parse(args)
+
+	config, err := app.ReadLocalConfig(options.configPath)
 	if err != nil {
 		panic(err)
 	}
 
-	logger := slog.New(tint.NewHandler(os.Stdout, &tint.Options{Level: slog.Level(config.Logging.Level)}))
+	logger := newLogger(os.Stdout, config)
 
-	db, err := sqlx.Connect(config.DB.DriverName, config.DB.ConnectionString)
+	tracerProvider, err := tracing.New(context.Background(), config.Tracing)
 	if err != nil {
 		panic(err)
 	}
 
-	defer func(db *sqlx.DB) {
-		err = db.Close()
+	defer func(tracerProvider *tracing.Provider) {
+		err = tracerProvider.Shutdown(context.Background())
 		if err != nil {
 			panic(err)
 		}
-	}(db)
+	}(tracerProvider)
 
-	dbInstance, err := sqlite3.WithInstance(db.DB, &sqlite3.Config{})
+	db := connectDB(config, options, logger)
+	defer closeDB(db)
+
+	validator, err := validation.New()
+	if err != nil {
+		panic(err)
+	}
+
+	var (
+		webAuth       fiber.Handler
+		authenticator app.Authenticator
+		authorizer    app.Authorizer
+	)
+
+	if config.Auth.Enabled {
+		jwtAuthenticator, err := auth.New(config.Auth)
+		if err != nil {
+			panic(err)
+		}
+
+		authenticator = jwtAuthenticator
+
+		if config.Auth.PolicyFile != "" {
+			policy, err := auth.LoadPolicy(config.Auth.PolicyFile)
+			if err != nil {
+				panic(err)
+			}
+
+			authorizer = app.NewOwnerAwareAuthorizer(policy, eventDelivery.OwnerAwareCalls(config.Web.PathPrefix))
+		}
+
+		webAuth = app.NewFiberAuth(authenticator, authorizer)
+	} else {
+		logger.Warn("authentication is disabled")
+	}
+
+	metrics, err := app.NewMetrics()
 	if err != nil {
 		panic(err)
 	}
 
-	err = migrations.Do(config.DB.DriverName, migrationsPath, dbInstance, logger)
+	dbMetrics, err := sqlxutils.NewMetrics(metrics.Registerer(), db)
 	if err != nil {
 		panic(err)
 	}
 
-	users := userDelivery.New(userUsecase.New(userRepository.NewSqlx(db, logger), logger), logger)
-	events := eventDelivery.New(eventUsecase.New(eventRepository.NewSqlx(db, logger), logger), logger)
+	observedDB := sqlxutils.NewDB(db, dbMetrics, sqlxutils.NewTracing(tracerProvider, config.DB.DriverName))
+
+	keys := idempotency.NewStore(observedDB, config.Idempotency)
+
+	userUseCase := userUsecase.New(userRepository.NewSqlx(observedDB, keys, logger), logger)
+	eventUseCase := eventUsecase.New(eventRepository.NewSqlx(observedDB, keys, logger), logger)
+
+	users := userDelivery.New(userUseCase, validator, logger)
+	events := eventDelivery.New(eventUseCase, validator, logger)
+
+	webApp := app.NewWebApp(config.Web, []app.WebDelivery{users, events}, webAuth, metrics, logger)
+	grpcApp := app.NewGrpcApp(config.GRPC, validator, authenticator, authorizer, metrics, logger, users, events)
 
-	webApp := app.NewWebApp(config.Web, nil, nil, logger)
-	grpcApp := app.NewGrpcApp(config.GRPC, logger, users, events)
+	purger := app.NewPurger(config.Purge, logger, userUseCase, eventUseCase, keys)
 
-	startApp(webApp, grpcApp, config, logger)
-	shutdownApp(webApp, grpcApp, logger)
+	startApp(webApp, grpcApp, purger, config, logger)
+	shutdownApp(webApp, grpcApp, purger, logger)
 }
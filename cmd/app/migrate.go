@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/Inspirate789/grpc-template/internal/pkg/app"
+	"github.com/Inspirate789/grpc-template/pkg/migrations"
+)
+
+const migrateUsage = `usage: app migrate [flags] COMMAND
+commands:
+  status        print the current version and the pending migrations
+  up [N]        apply N next migrations, all pending ones by default
+  down [N]      revert N last migrations, 1 by default
+  goto V        migrate up or down to version V
+  force V       set version V without running migrations, e.g. after fixing a failed one by hand
+  create NAME   add empty up and down migrations for all drivers
+flags:`
+
+func parseNumber(value string) uint {
+	version, err := strconv.ParseUint(value, 10, 0)
+	if err != nil {
+		usageError(fmt.Sprintf("invalid number %q", value))
+	}
+
+	return uint(version)
+}
+
+// confirmForce asks to type the version, since forcing a wrong one makes migrate skip or repeat migrations.
+func confirmForce(version uint) bool {
+	fmt.Fprintf(os.Stderr, "force sets the database version without running migrations; type %d to confirm: ", version)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(answer) == strconv.FormatUint(uint64(version), 10)
+}
+
+func printStatus(status migrations.Status) {
+	if status.Version == migrations.NilVersion {
+		fmt.Println("version: none")
+	} else {
+		fmt.Printf("version: %d\n", status.Version)
+	}
+
+	fmt.Printf("dirty: %t\n", status.Dirty)
+	if len(status.Changed) != 0 {
+		fmt.Printf("changed: %v\n", status.Changed)
+	}
+
+	fmt.Printf("pending: %d\n", len(status.Pending))
+
+	for _, migration := range status.Pending {
+		fmt.Printf("  %d %s\n", migration.Version, migration.Name)
+	}
+}
+
+// migrateCommand manages migrations of the configured database; logs go to stderr.
+func migrateCommand(args []string) {
+	var (
+		options commonOptions
+		yes     bool
+	)
+
+	flags := newFlagSet("migrate", &options)
+	flags.BoolVarP(&yes, "yes", "y", false, "Force without confirmation")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	command, commandArgs := flags.Arg(0), flags.Args()[min(1, flags.NArg()):]
+
+	var (
+		arg    string
+		number uint
+	)
+
+	switch {
+	case command == "status" && len(commandArgs) == 0:
+	case (command == "up" || command == "down") && len(commandArgs) <= 1,
+		(command == "goto" || command == "force" || command == "create") && len(commandArgs) == 1:
+		arg = strings.Join(commandArgs, "")
+	default:
+		flags.Usage()
+		os.Exit(exitCodeUsage)
+	}
+
+	if command == "create" {
+		// New migrations are written to the sources, so they are embedded on the next build.
+		migrationsPath := options.migrationsPath
+		if migrationsPath == "" {
+			migrationsPath = "migrations"
+		}
+
+		paths, err := migrations.Create(migrationsPath, arg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitCodeFailure)
+		}
+
+		for _, path := range paths {
+			fmt.Println(path)
+		}
+
+		return
+	} else if command == "down" && arg == "" {
+		number = 1
+	} else if arg != "" {
+		number = parseNumber(arg)
+	}
+
+	if command == "force" && !yes && !confirmForce(number) {
+		fmt.Fprintln(os.Stderr, "force is not confirmed")
+		os.Exit(exitCodeFailure)
+	}
+
+	config, err := app.ReadLocalConfig(options.configPath)
+	if err != nil {
+		panic(err)
+	}
+
+	logger := newLogger(os.Stderr, config)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+
+	db := openDB(config)
+
+	migrator, err := migrations.New(
+		ctx,
+		config.DB.DriverName,
+		migrationsFS(options, config.DB.DriverName),
+		db.DB,
+		config.Migrations,
+		logger,
+	)
+	if err == nil {
+		err = runMigrate(ctx, migrator, command, number)
+	}
+
+	closeDB(db)
+	cancel()
+
+	if err != nil {
+		logger.Error("migrate "+command+" failed", slog.String("error", err.Error()))
+		os.Exit(exitCodeFailure)
+	}
+}
+
+func runMigrate(ctx context.Context, migrator *migrations.Migrator, command string, number uint) error {
+	switch command {
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		printStatus(status)
+
+		return nil
+	case "up":
+		return migrator.Up(ctx, number)
+	case "down":
+		return migrator.Down(ctx, number)
+	case "goto":
+		return migrator.Goto(ctx, number)
+	default:
+		return migrator.Force(ctx, int(number))
+	}
+}
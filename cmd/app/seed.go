@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Inspirate789/grpc-template/internal/pkg/app"
+	"github.com/Inspirate789/grpc-template/internal/pkg/dump"
+	"github.com/Inspirate789/grpc-template/internal/pkg/seed"
+	"github.com/Inspirate789/grpc-template/pkg/sqlxutils"
+)
+
+// seedCommand loads SQL fixtures and generates a dataset of the given size, in this order.
+func seedCommand(args []string) {
+	var (
+		options   seed.Options
+		common    commonOptions
+		fixtures  string
+		start     string
+		batchSize int
+	)
+
+	flags := newStartupFlagSet("seed", &common)
+	flags.StringVar(&fixtures, "fixtures", "", "Directory with *.sql fixtures, e.g. migrations/test")
+	flags.Uint64Var(&options.Users, "users", 0, "Number of users to generate")
+	flags.Uint64Var(&options.Events, "events", 0, "Number of events to generate")
+	flags.Float64Var(&options.Density, "density", 0, "Expected share of the generated users participating in each event")
+	flags.Uint64Var(&options.Seed, "seed", 1, "Seed of the generated dataset")
+	flags.StringVar(&start, "start", "2025-01-01T00:00:00Z", "Earliest timestamp of the generated events, spread over a year")
+	flags.IntVar(&batchSize, "batch-size", dump.DefaultBatchSize, "Number of generated records inserted in one transaction")
+	_ = flags.Parse(args)
+
+	generate := options.Users != 0 || options.Events != 0
+	if fixtures == "" && !generate {
+		usageError("usage: app seed [--fixtures DIR] [--users N --events N --density D] [flags]")
+	}
+
+	var err error
+
+	options.Start, err = time.Parse(time.RFC3339, start)
+	if err != nil {
+		usageError("invalid --start: " + err.Error())
+	}
+
+	config, err := app.ReadLocalConfig(common.configPath)
+	if err != nil {
+		panic(err)
+	}
+
+	logger := newLogger(os.Stderr, config)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+
+	db := connectDB(config, common, logger)
+	err = runSeed(ctx, sqlxutils.NewDB(db), fixtures, generate, options, batchSize, logger)
+
+	closeDB(db)
+	cancel()
+
+	if err != nil {
+		logger.Error("seed failed", slog.String("error", err.Error()))
+		os.Exit(exitCodeFailure)
+	}
+}
+
+func runSeed(
+	ctx context.Context,
+	db *sqlxutils.DB,
+	fixtures string,
+	generate bool,
+	options seed.Options,
+	batchSize int,
+	logger *slog.Logger,
+) error {
+	if fixtures != "" {
+		names, err := seed.LoadFixtures(ctx, db, os.DirFS(fixtures))
+		if err != nil {
+			return err
+		}
+
+		logger.Info("fixtures loaded: " + strings.Join(names, ", "))
+	}
+
+	if !generate {
+		return nil
+	}
+
+	stats, err := seed.Generate(ctx, db, options, batchSize, logger)
+	if err != nil {
+		return err
+	}
+
+	logStats(logger, "dataset generated, inserted records", stats)
+
+	return nil
+}
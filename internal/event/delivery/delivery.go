@@ -1,131 +1,500 @@
 package delivery
 
 import (
+	"bytes"
 	"context"
 	"log/slog"
-	"math"
+	"slices"
 	"time"
 
 	"github.com/Inspirate789/grpc-template/internal/models"
+	"github.com/Inspirate789/grpc-template/internal/pkg/app"
+	"github.com/Inspirate789/grpc-template/internal/pkg/auth"
 	grpc "google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type UseCase interface {
 	HealthCheck(ctx context.Context) error
-	CreateEvent(ctx context.Context, name string, timestamp time.Time, userIDs []uint64) (id uint64, err error)
-	UpdateEvent(ctx context.Context, event models.Event) (found bool, err error)
-	DeleteEvent(ctx context.Context, id uint64) error
-	GetEvent(ctx context.Context, id uint64) (event models.Event, found bool, err error)
-	GetEvents(ctx context.Context, limit, offset uint64) ([]models.Event, uint64, error)
-	GetEventsByUser(ctx context.Context, userID, limit, offset uint64) ([]models.Event, uint64, error)
+	CreateEvent(ctx context.Context, event models.Event) (id uint64, err error)
+	UpdateEvent(ctx context.Context, event models.Event, mask models.FieldMask) (models.Event, error)
+	AddEventUsers(ctx context.Context, eventID uint64, userIDs []uint64) (models.Event, error)
+	RemoveEventUsers(ctx context.Context, eventID uint64, userIDs []uint64) (models.Event, error)
+	DeleteEvent(ctx context.Context, id, version uint64) error
+	GetEvent(ctx context.Context, id uint64, showDeleted bool) (models.Event, error)
+	GetEvents(ctx context.Context, filter models.EventFilter, page models.Page) ([]models.Event, uint64, error)
+	WatchEvents(
+		ctx context.Context,
+		filter models.EventChangeFilter,
+		fromRevision *uint64,
+		send func(change models.EventChange) error,
+	) error
+	BatchGetEvents(ctx context.Context, ids []uint64, showDeleted bool) (events []models.Event, missing []uint64, err error)
+	BatchDeleteEvents(ctx context.Context, ids []uint64, mode models.BatchMode) ([]models.BatchResult, error)
+	RestoreEvent(ctx context.Context, id uint64) (models.Event, error)
+	ListOccurrences(ctx context.Context, filter models.OccurrenceFilter, limit uint64) ([]models.Occurrence, error)
+	UpdateOccurrence(ctx context.Context, override models.OccurrenceOverride) (models.Occurrence, error)
+	CancelOccurrence(ctx context.Context, eventID uint64, recurrenceID time.Time) (models.Event, error)
+	ExportEvents(ctx context.Context, filter models.EventFilter) ([]models.CalendarEvent, error)
+	ExportEvent(ctx context.Context, id uint64) (models.CalendarEvent, error)
+	ImportEvents(ctx context.Context, events []models.CalendarEvent, matchAttendees bool) (models.CalendarImport, error)
+}
+
+type Validator interface {
+	Validate(msg proto.Message) error
 }
 
 type Delivery struct {
-	useCase UseCase
-	logger  *slog.Logger
+	useCase   UseCase
+	validator Validator
+	logger    *slog.Logger
 	UnimplementedEventServiceServer
 }
 
-func New(useCase UseCase, logger *slog.Logger) *Delivery {
+func New(useCase UseCase, validator Validator, logger *slog.Logger) *Delivery {
 	return &Delivery{
-		useCase: useCase,
-		logger:  logger,
+		useCase:   useCase,
+		validator: validator,
+		logger:    logger,
+	}
+}
+
+// OwnerAwareCalls lists the methods and the routes under pathPrefix whose usecases check that the principal
+// participates in the event, so the owner rule of the authorization policy may allow them.
+func OwnerAwareCalls(pathPrefix string) auth.Rules {
+	event := pathPrefix + "/events/*"
+
+	return auth.Rules{
+		Methods: []string{
+			EventService_UpdateEvent_FullMethodName,
+			EventService_AddEventUsers_FullMethodName,
+			EventService_RemoveEventUsers_FullMethodName,
+			EventService_DeleteEvent_FullMethodName,
+			EventService_RestoreEvent_FullMethodName,
+			EventService_UpdateOccurrence_FullMethodName,
+			EventService_CancelOccurrence_FullMethodName,
+		},
+		Routes: []string{
+			"PUT " + event,
+			"PATCH " + event,
+			"DELETE " + event,
+			"POST " + event + "/restore",
+			"PUT " + event + "/users/*",
+			"DELETE " + event + "/users/*",
+			"PUT " + event + "/occurrences/*",
+			"DELETE " + event + "/occurrences/*",
+		},
+	}
+}
+
+func newRecurrenceDTO(recurrence *models.Recurrence) *Recurrence {
+	if recurrence == nil {
+		return nil
+	}
+
+	dto := &Recurrence{
+		Rrule:    recurrence.RRule,
+		TimeZone: recurrence.TimeZone,
+		Exdates:  make([]*timestamppb.Timestamp, 0, len(recurrence.ExDates)),
+	}
+	for _, exDate := range recurrence.ExDates {
+		dto.Exdates = append(dto.Exdates, timestamppb.New(exDate))
+	}
+
+	return dto
+}
+
+func newRecurrenceModel(recurrence *Recurrence) *models.Recurrence {
+	if recurrence == nil {
+		return nil
+	}
+
+	model := &models.Recurrence{
+		RRule:    recurrence.GetRrule(),
+		TimeZone: recurrence.GetTimeZone(),
+		ExDates:  make([]time.Time, 0, len(recurrence.GetExdates())),
+	}
+	for _, exDate := range recurrence.GetExdates() {
+		model.ExDates = append(model.ExDates, exDate.AsTime())
+	}
+
+	return model
+}
+
+func newEventDTO(event models.Event) *Event {
+	return &Event{
+		Id:         event.ID,
+		Name:       event.Name,
+		Timestamp:  timestamppb.New(event.Timestamp),
+		UserIds:    event.UserIDs,
+		DeletedAt:  newTimestamp(event.DeletedAt),
+		Version:    event.Version,
+		Recurrence: newRecurrenceDTO(event.Recurrence),
 	}
 }
 
+func newEventModel(event *Event) models.Event {
+	model := models.Event{
+		ID:         event.GetId(),
+		Name:       event.GetName(),
+		Timestamp:  event.GetTimestamp().AsTime(),
+		UserIDs:    event.GetUserIds(),
+		Version:    event.GetVersion(),
+		Recurrence: newRecurrenceModel(event.GetRecurrence()),
+	}
+
+	if event.GetDeletedAt() != nil {
+		deletedAt := event.GetDeletedAt().AsTime()
+		model.DeletedAt = &deletedAt
+	}
+
+	return model
+}
+
 func (d *Delivery) Register(server grpc.ServiceRegistrar) {
 	RegisterEventServiceServer(server, d)
 }
 
+func (d *Delivery) ServiceName() string {
+	return EventService_ServiceDesc.ServiceName
+}
+
 func (d *Delivery) HealthCheck(ctx context.Context) error {
 	return d.useCase.HealthCheck(ctx)
 }
 
+func newCreateEventModel(request *CreateEventRequest) models.Event {
+	return models.Event{
+		Name:       request.GetName(),
+		Timestamp:  request.GetTimestamp().AsTime(),
+		UserIDs:    request.GetUserIds(),
+		Recurrence: newRecurrenceModel(request.GetRecurrence()),
+	}
+}
+
 func (d *Delivery) CreateEvent(ctx context.Context, request *CreateEventRequest) (*CreateEventResponse, error) {
-	id, err := d.useCase.CreateEvent(ctx, request.GetName(), request.GetTimestamp().AsTime(), request.GetUserIds())
+	id, err := d.useCase.CreateEvent(ctx, newCreateEventModel(request))
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, err
 	}
 
 	return &CreateEventResponse{Id: id}, nil
 }
 
 func (d *Delivery) UpdateEvent(ctx context.Context, request *UpdateEventRequest) (*UpdateEventResponse, error) {
-	event := models.Event{
-		ID:        request.GetEvent().GetId(),
-		Name:      request.GetEvent().GetName(),
-		Timestamp: request.GetEvent().GetTimestamp().AsTime(),
-		UserIDs:   request.GetEvent().GetUserIds(),
+	event, err := d.useCase.UpdateEvent(ctx, newEventModel(request.GetEvent()), request.GetUpdateMask().GetPaths())
+	if err != nil {
+		return nil, err
+	}
+
+	return &UpdateEventResponse{Event: newEventDTO(event)}, nil
+}
+
+func (d *Delivery) AddEventUsers(ctx context.Context, request *AddEventUsersRequest) (*AddEventUsersResponse, error) {
+	event, err := d.useCase.AddEventUsers(ctx, request.GetEventId(), request.GetUserIds())
+	if err != nil {
+		return nil, err
 	}
 
-	found, err := d.useCase.UpdateEvent(ctx, event)
+	return &AddEventUsersResponse{Event: newEventDTO(event)}, nil
+}
+
+func (d *Delivery) RemoveEventUsers(ctx context.Context, request *RemoveEventUsersRequest) (*RemoveEventUsersResponse, error) {
+	event, err := d.useCase.RemoveEventUsers(ctx, request.GetEventId(), request.GetUserIds())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
-	} else if !found {
-		return nil, status.Error(codes.NotFound, "event not found")
+		return nil, err
 	}
 
-	return &UpdateEventResponse{}, nil
+	return &RemoveEventUsersResponse{Event: newEventDTO(event)}, nil
 }
 
 func (d *Delivery) DeleteEvent(ctx context.Context, request *DeleteEventRequest) (*DeleteEventResponse, error) {
-	return &DeleteEventResponse{}, d.useCase.DeleteEvent(ctx, request.GetId())
+	err := d.useCase.DeleteEvent(ctx, request.GetId(), request.GetVersion())
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeleteEventResponse{}, nil
+}
+
+func (d *Delivery) RestoreEvent(ctx context.Context, request *RestoreEventRequest) (*RestoreEventResponse, error) {
+	event, err := d.useCase.RestoreEvent(ctx, request.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	return &RestoreEventResponse{Event: newEventDTO(event)}, nil
 }
 
 func (d *Delivery) GetEvent(ctx context.Context, request *GetEventRequest) (*GetEventResponse, error) {
-	event, found, err := d.useCase.GetEvent(ctx, request.GetId())
+	event, err := d.useCase.GetEvent(ctx, request.GetId(), request.GetShowDeleted())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
-	} else if !found {
-		return nil, status.Error(codes.NotFound, "event not found")
+		return nil, err
 	}
 
-	return &GetEventResponse{
-		Event: &Event{
-			Id:        event.ID,
-			Name:      event.Name,
-			Timestamp: timestamppb.New(event.Timestamp),
-			UserIds:   event.UserIDs,
-		},
-	}, nil
+	return &GetEventResponse{Event: newEventDTO(event)}, nil
+}
+
+func newEventFilter(request *ListEventsRequest) models.EventFilter {
+	filter := models.EventFilter{
+		NamePrefix:   request.GetNamePrefix(),
+		NameContains: request.GetNameContains(),
+		UserIDs:      request.GetUserIds(),
+		UserMatch:    models.UserMatchAny,
+	}
+
+	if request.GetFrom() != nil {
+		from := request.GetFrom().AsTime()
+		filter.From = &from
+	}
+
+	if request.GetTo() != nil {
+		to := request.GetTo().AsTime()
+		filter.To = &to
+	}
+
+	if request.UserId != nil {
+		filter.UserIDs = append(slices.Clone(filter.UserIDs), request.GetUserId())
+	}
+
+	if request.GetUserMatch() == UserMatch_USER_MATCH_ALL {
+		filter.UserMatch = models.UserMatchAll
+	}
+
+	switch request.GetOrder() {
+	case EventOrder_EVENT_ORDER_TIMESTAMP_DESC:
+		filter.Order = models.EventOrderTimestampDesc
+	case EventOrder_EVENT_ORDER_NAME:
+		filter.Order = models.EventOrderName
+	case EventOrder_EVENT_ORDER_ID:
+		filter.Order = models.EventOrderID
+	default:
+		filter.Order = models.EventOrderTimestamp
+	}
+
+	return filter
 }
 
 func (d *Delivery) GetEvents(ctx context.Context, request *ListEventsRequest) (*ListEventsResponse, error) {
-	userID := request.GetUserId()
-	offset := request.GetOffset()
 	limit := request.GetLimit()
 	if limit == 0 {
-		limit = math.MaxInt32
+		limit = models.DefaultPageLimit
 	}
 
-	var (
-		events     []models.Event
-		totalCount uint64
-		err        error
-	)
+	filter := newEventFilter(request)
+	query := models.NewPageQuery(filter.Order.String(), filter, request.GetShowDeleted())
 
-	if request.UserId != nil {
-		events, totalCount, err = d.useCase.GetEventsByUser(ctx, userID, limit, offset)
-	} else {
-		events, totalCount, err = d.useCase.GetEvents(ctx, limit, offset)
+	page, err := models.NewPage(limit+1, request.GetOffset(), request.GetPageToken(), !request.GetSkipTotalCount(), query)
+	if err != nil {
+		return nil, err
 	}
 
+	page.ShowDeleted = request.GetShowDeleted()
+
+	events, totalCount, err := d.useCase.GetEvents(ctx, filter, page)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, err
+	}
+
+	res := &ListEventsResponse{}
+
+	if uint64(len(events)) > limit {
+		events = events[:limit]
+		last := events[len(events)-1]
+		res.NextPageToken = models.Cursor{ID: last.ID, Timestamp: last.Timestamp, Name: last.Name, PageQuery: query}.Token()
+	}
+
+	if page.WithTotalCount {
+		res.TotalCount = &totalCount
 	}
 
-	dto := make([]*Event, 0, len(events))
+	res.Events = make([]*Event, 0, len(events))
 	for _, event := range events {
-		dto = append(dto, &Event{
-			Id:        event.ID,
-			Name:      event.Name,
-			Timestamp: timestamppb.New(event.Timestamp),
-			UserIds:   event.UserIDs,
+		res.Events = append(res.Events, newEventDTO(event))
+	}
+
+	return res, nil
+}
+
+func newOccurrenceDTO(occurrence models.Occurrence) *Occurrence {
+	return &Occurrence{
+		EventId:      occurrence.EventID,
+		RecurrenceId: timestamppb.New(occurrence.RecurrenceID),
+		Name:         occurrence.Name,
+		Timestamp:    timestamppb.New(occurrence.Timestamp),
+		UserIds:      occurrence.UserIDs,
+		Modified:     occurrence.Modified,
+	}
+}
+
+const defaultOccurrencesLimit = 1000
+
+func (d *Delivery) ListOccurrences(ctx context.Context, request *ListOccurrencesRequest) (*ListOccurrencesResponse, error) {
+	limit := uint64(defaultOccurrencesLimit)
+	if request.Limit != nil {
+		limit = request.GetLimit()
+	}
+
+	filter := models.OccurrenceFilter{
+		From:    request.GetFrom().AsTime(),
+		To:      request.GetTo().AsTime(),
+		EventID: request.EventId,
+		UserID:  request.UserId,
+	}
+
+	occurrences, err := d.useCase.ListOccurrences(ctx, filter, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ListOccurrencesResponse{
+		Occurrences: make([]*Occurrence, 0, len(occurrences)),
+	}
+	for _, occurrence := range occurrences {
+		res.Occurrences = append(res.Occurrences, newOccurrenceDTO(occurrence))
+	}
+
+	return res, nil
+}
+
+func (d *Delivery) UpdateOccurrence(ctx context.Context, request *UpdateOccurrenceRequest) (*UpdateOccurrenceResponse, error) {
+	occurrence, err := d.useCase.UpdateOccurrence(ctx, models.OccurrenceOverride{
+		EventID:      request.GetEventId(),
+		RecurrenceID: request.GetRecurrenceId().AsTime(),
+		Name:         request.GetName(),
+		Timestamp:    request.GetTimestamp().AsTime(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &UpdateOccurrenceResponse{Occurrence: newOccurrenceDTO(occurrence)}, nil
+}
+
+func (d *Delivery) CancelOccurrence(ctx context.Context, request *CancelOccurrenceRequest) (*CancelOccurrenceResponse, error) {
+	event, err := d.useCase.CancelOccurrence(ctx, request.GetEventId(), request.GetRecurrenceId().AsTime())
+	if err != nil {
+		return nil, err
+	}
+
+	return &CancelOccurrenceResponse{Event: newEventDTO(event)}, nil
+}
+
+func newChangeType(changeType models.ChangeType) ChangeType {
+	switch changeType {
+	case models.ChangeCreated:
+		return ChangeType_CHANGE_TYPE_CREATED
+	case models.ChangeUpdated:
+		return ChangeType_CHANGE_TYPE_UPDATED
+	case models.ChangeDeleted:
+		return ChangeType_CHANGE_TYPE_DELETED
+	case models.ChangeRestored:
+		return ChangeType_CHANGE_TYPE_RESTORED
+	default:
+		return ChangeType_CHANGE_TYPE_UNSPECIFIED
+	}
+}
+
+func (d *Delivery) WatchEvents(request *WatchEventsRequest, stream grpc.ServerStreamingServer[WatchEventsResponse]) error {
+	filter := models.EventChangeFilter{
+		UserID: request.UserId,
+	}
+
+	if request.GetFrom() != nil {
+		from := request.GetFrom().AsTime()
+		filter.From = &from
+	}
+
+	if request.GetTo() != nil {
+		to := request.GetTo().AsTime()
+		filter.To = &to
+	}
+
+	return d.useCase.WatchEvents(stream.Context(), filter, request.FromRevision, func(change models.EventChange) error {
+		return stream.Send(&WatchEventsResponse{
+			Revision: change.Revision,
+			Type:     newChangeType(change.Type),
+			Event:    newEventDTO(change.Event),
 		})
+	})
+}
+
+func newBatchMode(mode BatchMode) models.BatchMode {
+	if mode == BatchMode_BATCH_MODE_BEST_EFFORT {
+		return models.BatchBestEffort
+	}
+
+	return models.BatchAtomic
+}
+
+func (d *Delivery) newBatchItemStatus(ctx context.Context, err error) *BatchItemStatus {
+	st := app.ErrorStatus(err)
+	if st.Code() == codes.Internal {
+		d.logger.ErrorContext(ctx, err.Error())
+	}
+
+	return &BatchItemStatus{
+		Code:    uint32(st.Code()),
+		Message: st.Message(),
+	}
+}
+
+func (d *Delivery) BatchGetEvents(ctx context.Context, request *BatchGetEventsRequest) (*BatchGetEventsResponse, error) {
+	events, missing, err := d.useCase.BatchGetEvents(ctx, request.GetIds(), request.GetShowDeleted())
+	if err != nil {
+		return nil, err
+	}
+
+	res := &BatchGetEventsResponse{
+		Events:     make([]*Event, 0, len(events)),
+		MissingIds: missing,
+	}
+	for _, event := range events {
+		res.Events = append(res.Events, newEventDTO(event))
+	}
+
+	return res, nil
+}
+
+func (d *Delivery) BatchDeleteEvents(ctx context.Context, request *BatchDeleteEventsRequest) (*BatchDeleteEventsResponse, error) {
+	results, err := d.useCase.BatchDeleteEvents(ctx, request.GetIds(), newBatchMode(request.GetMode()))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &BatchDeleteEventsResponse{
+		Results: make([]*BatchDeleteEventsResponse_Result, 0, len(results)),
+	}
+	for _, result := range results {
+		res.Results = append(res.Results, &BatchDeleteEventsResponse_Result{
+			Id:     result.ID,
+			Status: d.newBatchItemStatus(ctx, result.Err),
+		})
+	}
+
+	return res, nil
+}
+
+func (d *Delivery) ImportEvents(ctx context.Context, request *ImportEventsRequest) (*ImportEventsResponse, error) {
+	events, err := readCalendar(bytes.NewReader(request.GetCalendar()))
+	if err != nil {
+		return nil, err
+	}
+
+	imported, err := d.useCase.ImportEvents(ctx, events, request.GetMatchAttendees())
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ImportEventsResponse{
+		Ids:                make([]uint64, 0, len(imported.Events)),
+		UnmatchedAttendees: imported.UnmatchedAttendees,
+	}
+	for _, event := range imported.Events {
+		res.Ids = append(res.Ids, event.ID)
 	}
 
-	return &ListEventsResponse{Events: dto, TotalCount: totalCount}, nil
+	return res, nil
 }
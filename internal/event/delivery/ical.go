@@ -0,0 +1,285 @@
+package delivery
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Inspirate789/grpc-template/internal/models"
+	ics "github.com/arran4/golang-ical"
+)
+
+const (
+	icalUTCLayout   = "20060102T150405Z"
+	icalLocalLayout = "20060102T150405"
+	icalDateLayout  = "20060102"
+	icalProductID   = "-//Inspirate789//grpc-template//EN"
+)
+
+const (
+	maxImportedEvents  = 1000
+	maxEventNameLength = 256
+)
+
+func invalidCalendar(description string) error {
+	return models.NewInvalidArgumentError(models.FieldViolation{
+		Field:       "calendar",
+		Description: description,
+	})
+}
+
+// icalTime formats t in UTC or, for events expanded in another time zone, as a local time with TZID.
+func icalTime(t time.Time, location *time.Location) (string, []ics.PropertyParameter) {
+	if location == time.UTC {
+		return t.UTC().Format(icalUTCLayout), nil
+	}
+
+	return t.In(location).Format(icalLocalLayout), []ics.PropertyParameter{ics.WithTZID(location.String())}
+}
+
+func setTime(component *ics.ComponentBase, property ics.ComponentProperty, t time.Time, location *time.Location) {
+	value, params := icalTime(t, location)
+	component.SetProperty(property, value, params...)
+}
+
+func addVEvent(
+	calendar *ics.Calendar,
+	uid string,
+	event models.CalendarEvent,
+	now time.Time,
+) *ics.VEvent {
+	vevent := calendar.AddEvent(uid)
+	vevent.SetDtStampTime(now)
+	vevent.SetSummary(event.Event.Name)
+	vevent.SetSequence(int(event.Event.Version))
+
+	for i, userID := range event.Event.UserIDs {
+		uri := "urn:user:" + strconv.FormatUint(userID, 10)
+		vevent.AddProperty(ics.ComponentPropertyAttendee, uri, ics.WithCN(event.Attendees[i]))
+	}
+
+	return vevent
+}
+
+// writeCalendar renders events as iCalendar: a VEVENT per event and per changed occurrence of a recurring
+// event. UIDs are made of event ids and host.
+func writeCalendar(w io.Writer, events []models.CalendarEvent, host string) error {
+	calendar := ics.NewCalendar()
+	calendar.SetProductId(icalProductID)
+	calendar.SetMethod(ics.MethodPublish)
+
+	now := time.Now()
+
+	for _, event := range events {
+		uid := strconv.FormatUint(event.Event.ID, 10) + "@" + host
+
+		location := time.UTC
+
+		recurrence := event.Event.Recurrence
+		if recurrence != nil && recurrence.TimeZone != "" {
+			var err error
+
+			location, err = time.LoadLocation(recurrence.TimeZone)
+			if err != nil {
+				return err
+			}
+		}
+
+		vevent := addVEvent(calendar, uid, event, now)
+		setTime(&vevent.ComponentBase, ics.ComponentPropertyDtStart, event.Event.Timestamp, location)
+
+		if recurrence == nil {
+			continue
+		}
+
+		vevent.AddRrule(recurrence.RRule)
+
+		for _, exDate := range recurrence.ExDates {
+			value, params := icalTime(exDate, location)
+			vevent.AddExdate(value, params...)
+		}
+
+		for _, override := range event.Overrides {
+			vevent = addVEvent(calendar, uid, event, now)
+			vevent.SetSummary(override.Name)
+			setTime(&vevent.ComponentBase, ics.ComponentPropertyRecurrenceId, override.RecurrenceID, location)
+			setTime(&vevent.ComponentBase, ics.ComponentPropertyDtStart, override.Timestamp, location)
+		}
+	}
+
+	return calendar.SerializeTo(w)
+}
+
+// readTime parses a DATE-TIME or DATE value of a property in the time zone given by its TZID.
+// Floating times are read as UTC.
+func readTime(value string, property *ics.IANAProperty) (time.Time, *time.Location, error) {
+	location := time.UTC
+
+	tzid := property.ICalParameters[string(ics.ParameterTzid)]
+	if len(tzid) != 0 {
+		var err error
+
+		location, err = time.LoadLocation(tzid[0])
+		if err != nil {
+			return time.Time{}, nil, invalidCalendar("unknown TZID " + strconv.Quote(tzid[0]))
+		}
+	}
+
+	for _, layout := range []string{icalUTCLayout, icalLocalLayout, icalDateLayout} {
+		t, err := time.ParseInLocation(layout, value, location)
+		if err == nil {
+			return t, location, nil
+		}
+	}
+
+	return time.Time{}, nil, invalidCalendar("invalid " + property.IANAToken + " " + strconv.Quote(value))
+}
+
+func readRequiredTime(vevent *ics.VEvent, property ics.ComponentProperty) (time.Time, *time.Location, error) {
+	prop := vevent.GetProperty(property)
+	if prop == nil {
+		return time.Time{}, nil, invalidCalendar("VEVENT " + strconv.Quote(vevent.Id()) + " has no " + string(property))
+	}
+
+	return readTime(prop.Value, prop)
+}
+
+func readName(vevent *ics.VEvent) (string, error) {
+	summary := vevent.GetProperty(ics.ComponentPropertySummary)
+	if summary == nil || summary.Value == "" || len([]rune(summary.Value)) > maxEventNameLength {
+		return "", invalidCalendar("SUMMARY of VEVENT " + strconv.Quote(vevent.Id()) +
+			" must be 1 to " + strconv.Itoa(maxEventNameLength) + " characters")
+	}
+
+	return summary.Value, nil
+}
+
+func readRecurrence(vevent *ics.VEvent, rrule string, location *time.Location) (*models.Recurrence, error) {
+	recurrence := &models.Recurrence{RRule: rrule}
+	if location != time.UTC {
+		recurrence.TimeZone = location.String()
+	}
+
+	for _, exDate := range vevent.GetProperties(ics.ComponentPropertyExdate) {
+		for _, value := range strings.Split(exDate.Value, ",") {
+			t, _, err := readTime(value, exDate)
+			if err != nil {
+				return nil, err
+			}
+
+			recurrence.ExDates = append(recurrence.ExDates, t.UTC())
+		}
+	}
+
+	return recurrence, nil
+}
+
+func readEvent(vevent *ics.VEvent) (models.CalendarEvent, error) {
+	name, err := readName(vevent)
+	if err != nil {
+		return models.CalendarEvent{}, err
+	}
+
+	start, location, err := readRequiredTime(vevent, ics.ComponentPropertyDtStart)
+	if err != nil {
+		return models.CalendarEvent{}, err
+	}
+
+	event := models.CalendarEvent{
+		Event: models.Event{
+			Name:      name,
+			Timestamp: start.UTC(),
+		},
+		Attendees: make([]string, 0),
+	}
+
+	rrule := vevent.GetProperty(ics.ComponentPropertyRrule)
+	if rrule != nil {
+		event.Event.Recurrence, err = readRecurrence(vevent, rrule.Value, location)
+		if err != nil {
+			return models.CalendarEvent{}, err
+		}
+	}
+
+	for _, attendee := range vevent.Attendees() {
+		cn := attendee.ICalParameters[string(ics.ParameterCn)]
+		if len(cn) != 0 && cn[0] != "" {
+			event.Attendees = append(event.Attendees, cn[0])
+		}
+	}
+
+	return event, nil
+}
+
+func readOverride(vevent *ics.VEvent) (models.OccurrenceOverride, error) {
+	name, err := readName(vevent)
+	if err != nil {
+		return models.OccurrenceOverride{}, err
+	}
+
+	recurrenceID, _, err := readRequiredTime(vevent, ics.ComponentPropertyRecurrenceId)
+	if err != nil {
+		return models.OccurrenceOverride{}, err
+	}
+
+	start, _, err := readRequiredTime(vevent, ics.ComponentPropertyDtStart)
+	if err != nil {
+		return models.OccurrenceOverride{}, err
+	}
+
+	return models.OccurrenceOverride{
+		RecurrenceID: recurrenceID.UTC(),
+		Name:         name,
+		Timestamp:    start.UTC(),
+	}, nil
+}
+
+// readCalendar reads the events of an iCalendar. VEVENTs with a RECURRENCE-ID become overrides
+// of occurrences of the event with the same UID.
+func readCalendar(r io.Reader) ([]models.CalendarEvent, error) {
+	calendar, err := ics.ParseCalendar(r)
+	if err != nil {
+		return nil, invalidCalendar(err.Error())
+	}
+
+	events := make([]models.CalendarEvent, 0)
+	byUID := make(map[string]int)
+	overrides := make([]*ics.VEvent, 0)
+
+	for _, vevent := range calendar.Events() {
+		if vevent.GetProperty(ics.ComponentPropertyRecurrenceId) != nil {
+			overrides = append(overrides, vevent)
+			continue
+		}
+
+		event, err := readEvent(vevent)
+		if err != nil {
+			return nil, err
+		}
+
+		byUID[vevent.Id()] = len(events)
+		events = append(events, event)
+	}
+
+	if len(events) == 0 || len(events) > maxImportedEvents {
+		return nil, invalidCalendar("calendar must contain 1 to " + strconv.Itoa(maxImportedEvents) + " events")
+	}
+
+	for _, vevent := range overrides {
+		i, ok := byUID[vevent.Id()]
+		if !ok || events[i].Event.Recurrence == nil {
+			return nil, invalidCalendar("RECURRENCE-ID of VEVENT " + strconv.Quote(vevent.Id()) +
+				" does not refer to a recurring event")
+		}
+
+		override, err := readOverride(vevent)
+		if err != nil {
+			return nil, err
+		}
+
+		events[i].Overrides = append(events[i].Overrides, override)
+	}
+
+	return events, nil
+}
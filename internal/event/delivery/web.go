@@ -0,0 +1,781 @@
+package delivery
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Inspirate789/grpc-template/internal/models"
+	"github.com/Inspirate789/grpc-template/internal/pkg/app"
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type recurrenceJSON struct {
+	RRule    string      `json:"rrule"`
+	TimeZone string      `json:"time_zone,omitempty"`
+	ExDates  []time.Time `json:"exdates,omitempty"`
+}
+
+type eventJSON struct {
+	ID         uint64          `json:"id"`
+	Name       string          `json:"name"`
+	Timestamp  time.Time       `json:"timestamp"`
+	UserIDs    []uint64        `json:"user_ids"`
+	DeletedAt  *time.Time      `json:"deleted_at,omitempty"`
+	Version    uint64          `json:"version"`
+	Recurrence *recurrenceJSON `json:"recurrence,omitempty"`
+}
+
+type occurrenceJSON struct {
+	EventID      uint64    `json:"event_id"`
+	RecurrenceID time.Time `json:"recurrence_id"`
+	Name         string    `json:"name"`
+	Timestamp    time.Time `json:"timestamp"`
+	UserIDs      []uint64  `json:"user_ids"`
+	Modified     bool      `json:"modified"`
+}
+
+type occurrencesJSON struct {
+	Occurrences []occurrenceJSON `json:"occurrences"`
+}
+
+type eventsJSON struct {
+	Events        []eventJSON `json:"events"`
+	TotalCount    *uint64     `json:"total_count,omitempty"`
+	NextPageToken string      `json:"next_page_token,omitempty"`
+}
+
+type createEventJSON struct {
+	Name       string          `json:"name"`
+	Timestamp  *time.Time      `json:"timestamp"`
+	UserIDs    []uint64        `json:"user_ids"`
+	Recurrence *recurrenceJSON `json:"recurrence"`
+}
+
+// patchEventJSON updates only the fields present in the body.
+type patchEventJSON struct {
+	Name       *string         `json:"name"`
+	Timestamp  *time.Time      `json:"timestamp"`
+	UserIDs    *[]uint64       `json:"user_ids"`
+	Recurrence *recurrenceJSON `json:"recurrence"`
+}
+
+type updateOccurrenceJSON struct {
+	Name      string     `json:"name"`
+	Timestamp *time.Time `json:"timestamp"`
+}
+
+type listOccurrencesQuery struct {
+	From    string  `query:"from"`
+	To      string  `query:"to"`
+	EventID *uint64 `query:"event_id"`
+	UserID  *uint64 `query:"user_id"`
+	Limit   *uint64 `query:"limit"`
+}
+
+type listEventsQuery struct {
+	Limit          *uint64  `query:"limit"`
+	Offset         *uint64  `query:"offset"`
+	UserID         *uint64  `query:"user_id"`
+	PageToken      string   `query:"page_token"`
+	SkipTotalCount bool     `query:"skip_total_count"`
+	ShowDeleted    bool     `query:"show_deleted"`
+	From           string   `query:"from"`
+	To             string   `query:"to"`
+	NamePrefix     string   `query:"name_prefix"`
+	NameContains   string   `query:"name_contains"`
+	UserIDs        []uint64 `query:"user_ids"`
+	UserMatch      string   `query:"user_match"`
+	Order          string   `query:"order"`
+}
+
+type importEventsQuery struct {
+	MatchAttendees bool `query:"match_attendees"`
+}
+
+type importEventsJSON struct {
+	IDs                []uint64 `json:"ids"`
+	UnmatchedAttendees []string `json:"unmatched_attendees"`
+}
+
+type getEventQuery struct {
+	ShowDeleted bool `query:"show_deleted"`
+}
+
+type idJSON struct {
+	ID uint64 `json:"id"`
+}
+
+func newEventJSON(event models.Event) eventJSON {
+	userIDs := event.UserIDs
+	if userIDs == nil {
+		userIDs = make([]uint64, 0)
+	}
+
+	res := eventJSON{
+		ID:         event.ID,
+		Name:       event.Name,
+		Timestamp:  event.Timestamp,
+		UserIDs:    userIDs,
+		DeletedAt:  event.DeletedAt,
+		Version:    event.Version,
+		Recurrence: nil,
+	}
+
+	if event.Recurrence != nil {
+		res.Recurrence = &recurrenceJSON{
+			RRule:    event.Recurrence.RRule,
+			TimeZone: event.Recurrence.TimeZone,
+			ExDates:  event.Recurrence.ExDates,
+		}
+	}
+
+	return res
+}
+
+func newOccurrenceJSON(occurrence models.Occurrence) occurrenceJSON {
+	userIDs := occurrence.UserIDs
+	if userIDs == nil {
+		userIDs = make([]uint64, 0)
+	}
+
+	return occurrenceJSON{
+		EventID:      occurrence.EventID,
+		RecurrenceID: occurrence.RecurrenceID,
+		Name:         occurrence.Name,
+		Timestamp:    occurrence.Timestamp,
+		UserIDs:      userIDs,
+		Modified:     occurrence.Modified,
+	}
+}
+
+func newRecurrenceRequest(recurrence *recurrenceJSON) *Recurrence {
+	if recurrence == nil {
+		return nil
+	}
+
+	res := &Recurrence{
+		Rrule:    recurrence.RRule,
+		TimeZone: recurrence.TimeZone,
+		Exdates:  make([]*timestamppb.Timestamp, 0, len(recurrence.ExDates)),
+	}
+	for _, exDate := range recurrence.ExDates {
+		res.Exdates = append(res.Exdates, timestamppb.New(exDate))
+	}
+
+	return res
+}
+
+func newTimestamp(timestamp *time.Time) *timestamppb.Timestamp {
+	if timestamp == nil {
+		return nil
+	}
+
+	return timestamppb.New(*timestamp)
+}
+
+func parseID(ctx *fiber.Ctx) (uint64, error) {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 64)
+	if err != nil {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "invalid event id")
+	}
+
+	return id, nil
+}
+
+func parseUserID(ctx *fiber.Ctx) (uint64, error) {
+	id, err := strconv.ParseUint(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "invalid user id")
+	}
+
+	return id, nil
+}
+
+func parseTime(value, name string) (*timestamppb.Timestamp, error) {
+	timestamp, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "invalid "+name+": expected an RFC 3339 time")
+	}
+
+	return timestamppb.New(timestamp), nil
+}
+
+// parseEnum returns the value of a proto enum given by the lowercase name of the value without
+// the prefix, e.g. "timestamp_desc" for EVENT_ORDER_TIMESTAMP_DESC; empty means the zero value.
+func parseEnum(value, name, prefix string, values map[string]int32) (int32, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	res, ok := values[prefix+strings.ToUpper(value)]
+	if !ok {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "invalid "+name)
+	}
+
+	return res, nil
+}
+
+func parseRecurrenceID(ctx *fiber.Ctx) (*timestamppb.Timestamp, error) {
+	value, err := url.PathUnescape(ctx.Params("recurrence_id"))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "invalid recurrence id")
+	}
+
+	return parseTime(value, "recurrence id")
+}
+
+func (d *Delivery) AddHandlers(router fiber.Router) {
+	events := router.Group("/events")
+	events.Post("/", d.createEventHandler)
+	events.Get("/", d.getEventsHandler)
+	events.Get("/occurrences", d.listOccurrencesHandler)
+	events.Post("/import", d.importEventsHandler)
+	events.Put("/:id/occurrences/:recurrence_id", d.updateOccurrenceHandler)
+	events.Delete("/:id/occurrences/:recurrence_id", d.cancelOccurrenceHandler)
+	events.Get("/:id.ics", d.exportEventHandler)
+	events.Get("/:id", d.getEventHandler)
+	events.Put("/:id", d.updateEventHandler)
+	events.Patch("/:id", d.patchEventHandler)
+	events.Put("/:id/users/:user_id", d.addEventUserHandler)
+	events.Delete("/:id/users/:user_id", d.removeEventUserHandler)
+	events.Delete("/:id", d.deleteEventHandler)
+	events.Post("/:id/restore", d.restoreEventHandler)
+	router.Get("/users/:user_id/calendar.ics", d.exportUserEventsHandler)
+}
+
+func (d *Delivery) createEventHandler(ctx *fiber.Ctx) error {
+	var body createEventJSON
+
+	err := ctx.BodyParser(&body)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	request := &CreateEventRequest{
+		Name:       body.Name,
+		Timestamp:  newTimestamp(body.Timestamp),
+		UserIds:    body.UserIDs,
+		Recurrence: newRecurrenceRequest(body.Recurrence),
+	}
+
+	err = d.validator.Validate(request)
+	if err != nil {
+		return err
+	}
+
+	id, err := d.useCase.CreateEvent(ctx.UserContext(), newCreateEventModel(request))
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(idJSON{ID: id})
+}
+
+func (d *Delivery) updateEventHandler(ctx *fiber.Ctx) error {
+	id, err := parseID(ctx)
+	if err != nil {
+		return err
+	}
+
+	version, err := app.IfMatch(ctx)
+	if err != nil {
+		return err
+	}
+
+	var body createEventJSON
+
+	err = ctx.BodyParser(&body)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	request := &UpdateEventRequest{
+		Event: &Event{
+			Id:         id,
+			Name:       body.Name,
+			Timestamp:  newTimestamp(body.Timestamp),
+			UserIds:    body.UserIDs,
+			Version:    version,
+			Recurrence: newRecurrenceRequest(body.Recurrence),
+		},
+	}
+
+	err = d.validator.Validate(request)
+	if err != nil {
+		return err
+	}
+
+	event, err := d.useCase.UpdateEvent(ctx.UserContext(), newEventModel(request.GetEvent()), nil)
+	if err != nil {
+		return err
+	}
+
+	app.SetETag(ctx, event.Version)
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+func (d *Delivery) patchEventHandler(ctx *fiber.Ctx) error {
+	id, err := parseID(ctx)
+	if err != nil {
+		return err
+	}
+
+	version, err := app.IfMatch(ctx)
+	if err != nil {
+		return err
+	}
+
+	var body patchEventJSON
+
+	err = ctx.BodyParser(&body)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	request := &UpdateEventRequest{
+		Event:      &Event{Id: id, Version: version},
+		UpdateMask: &fieldmaskpb.FieldMask{},
+	}
+
+	if body.Name != nil {
+		request.Event.Name = *body.Name
+		request.UpdateMask.Paths = append(request.UpdateMask.Paths, models.EventFieldName)
+	}
+
+	if body.Timestamp != nil {
+		request.Event.Timestamp = newTimestamp(body.Timestamp)
+		request.UpdateMask.Paths = append(request.UpdateMask.Paths, models.EventFieldTimestamp)
+	}
+
+	if body.UserIDs != nil {
+		request.Event.UserIds = *body.UserIDs
+		request.UpdateMask.Paths = append(request.UpdateMask.Paths, models.EventFieldUserIDs)
+	}
+
+	if body.Recurrence != nil {
+		request.Event.Recurrence = newRecurrenceRequest(body.Recurrence)
+		request.UpdateMask.Paths = append(request.UpdateMask.Paths, models.EventFieldRecurrence)
+	}
+
+	if len(request.GetUpdateMask().GetPaths()) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "nothing to update")
+	}
+
+	err = d.validator.Validate(request)
+	if err != nil {
+		return err
+	}
+
+	event, err := d.useCase.UpdateEvent(ctx.UserContext(), newEventModel(request.GetEvent()), request.GetUpdateMask().GetPaths())
+	if err != nil {
+		return err
+	}
+
+	app.SetETag(ctx, event.Version)
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+func (d *Delivery) addEventUserHandler(ctx *fiber.Ctx) error {
+	id, err := parseID(ctx)
+	if err != nil {
+		return err
+	}
+
+	userID, err := parseUserID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = d.validator.Validate(&AddEventUsersRequest{EventId: id, UserIds: []uint64{userID}})
+	if err != nil {
+		return err
+	}
+
+	event, err := d.useCase.AddEventUsers(ctx.UserContext(), id, []uint64{userID})
+	if err != nil {
+		return err
+	}
+
+	app.SetETag(ctx, event.Version)
+
+	return ctx.JSON(newEventJSON(event))
+}
+
+func (d *Delivery) removeEventUserHandler(ctx *fiber.Ctx) error {
+	id, err := parseID(ctx)
+	if err != nil {
+		return err
+	}
+
+	userID, err := parseUserID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = d.validator.Validate(&RemoveEventUsersRequest{EventId: id, UserIds: []uint64{userID}})
+	if err != nil {
+		return err
+	}
+
+	event, err := d.useCase.RemoveEventUsers(ctx.UserContext(), id, []uint64{userID})
+	if err != nil {
+		return err
+	}
+
+	app.SetETag(ctx, event.Version)
+
+	return ctx.JSON(newEventJSON(event))
+}
+
+func (d *Delivery) deleteEventHandler(ctx *fiber.Ctx) error {
+	id, err := parseID(ctx)
+	if err != nil {
+		return err
+	}
+
+	version, err := app.IfMatch(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = d.validator.Validate(&DeleteEventRequest{Id: id, Version: version})
+	if err != nil {
+		return err
+	}
+
+	err = d.useCase.DeleteEvent(ctx.UserContext(), id, version)
+	if err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+func (d *Delivery) restoreEventHandler(ctx *fiber.Ctx) error {
+	id, err := parseID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = d.validator.Validate(&RestoreEventRequest{Id: id})
+	if err != nil {
+		return err
+	}
+
+	event, err := d.useCase.RestoreEvent(ctx.UserContext(), id)
+	if err != nil {
+		return err
+	}
+
+	app.SetETag(ctx, event.Version)
+
+	return ctx.JSON(newEventJSON(event))
+}
+
+func (d *Delivery) getEventHandler(ctx *fiber.Ctx) error {
+	id, err := parseID(ctx)
+	if err != nil {
+		return err
+	}
+
+	var query getEventQuery
+
+	err = ctx.QueryParser(&query)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	err = d.validator.Validate(&GetEventRequest{Id: id, ShowDeleted: query.ShowDeleted})
+	if err != nil {
+		return err
+	}
+
+	event, err := d.useCase.GetEvent(ctx.UserContext(), id, query.ShowDeleted)
+	if err != nil {
+		return err
+	}
+
+	app.SetETag(ctx, event.Version)
+
+	return ctx.JSON(newEventJSON(event))
+}
+
+func (d *Delivery) getEventsHandler(ctx *fiber.Ctx) error {
+	var query listEventsQuery
+
+	err := ctx.QueryParser(&query)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	userMatch, err := parseEnum(query.UserMatch, "user_match", "USER_MATCH_", UserMatch_value)
+	if err != nil {
+		return err
+	}
+
+	order, err := parseEnum(query.Order, "order", "EVENT_ORDER_", EventOrder_value)
+	if err != nil {
+		return err
+	}
+
+	request := &ListEventsRequest{
+		Limit:          query.Limit,
+		Offset:         query.Offset,
+		UserId:         query.UserID,
+		PageToken:      query.PageToken,
+		SkipTotalCount: query.SkipTotalCount,
+		ShowDeleted:    query.ShowDeleted,
+		NamePrefix:     query.NamePrefix,
+		NameContains:   query.NameContains,
+		UserIds:        query.UserIDs,
+		UserMatch:      UserMatch(userMatch),
+		Order:          EventOrder(order),
+	}
+
+	if query.From != "" {
+		request.From, err = parseTime(query.From, "from")
+		if err != nil {
+			return err
+		}
+	}
+
+	if query.To != "" {
+		request.To, err = parseTime(query.To, "to")
+		if err != nil {
+			return err
+		}
+	}
+
+	err = d.validator.Validate(request)
+	if err != nil {
+		return err
+	}
+
+	response, err := d.GetEvents(ctx.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	res := eventsJSON{
+		Events:        make([]eventJSON, 0, len(response.GetEvents())),
+		TotalCount:    response.TotalCount,
+		NextPageToken: response.GetNextPageToken(),
+	}
+	for _, event := range response.GetEvents() {
+		res.Events = append(res.Events, newEventJSON(newEventModel(event)))
+	}
+
+	return ctx.JSON(res)
+}
+
+func (d *Delivery) listOccurrencesHandler(ctx *fiber.Ctx) error {
+	var query listOccurrencesQuery
+
+	err := ctx.QueryParser(&query)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	from, err := parseTime(query.From, "from")
+	if err != nil {
+		return err
+	}
+
+	to, err := parseTime(query.To, "to")
+	if err != nil {
+		return err
+	}
+
+	request := &ListOccurrencesRequest{
+		From:    from,
+		To:      to,
+		EventId: query.EventID,
+		UserId:  query.UserID,
+		Limit:   query.Limit,
+	}
+
+	err = d.validator.Validate(request)
+	if err != nil {
+		return err
+	}
+
+	response, err := d.ListOccurrences(ctx.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	res := occurrencesJSON{
+		Occurrences: make([]occurrenceJSON, 0, len(response.GetOccurrences())),
+	}
+	for _, occurrence := range response.GetOccurrences() {
+		res.Occurrences = append(res.Occurrences, newOccurrenceJSON(models.Occurrence{
+			EventID:      occurrence.GetEventId(),
+			RecurrenceID: occurrence.GetRecurrenceId().AsTime(),
+			Name:         occurrence.GetName(),
+			Timestamp:    occurrence.GetTimestamp().AsTime(),
+			UserIDs:      occurrence.GetUserIds(),
+			Modified:     occurrence.GetModified(),
+		}))
+	}
+
+	return ctx.JSON(res)
+}
+
+func (d *Delivery) updateOccurrenceHandler(ctx *fiber.Ctx) error {
+	id, err := parseID(ctx)
+	if err != nil {
+		return err
+	}
+
+	recurrenceID, err := parseRecurrenceID(ctx)
+	if err != nil {
+		return err
+	}
+
+	var body updateOccurrenceJSON
+
+	err = ctx.BodyParser(&body)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	request := &UpdateOccurrenceRequest{
+		EventId:      id,
+		RecurrenceId: recurrenceID,
+		Name:         body.Name,
+		Timestamp:    newTimestamp(body.Timestamp),
+	}
+
+	err = d.validator.Validate(request)
+	if err != nil {
+		return err
+	}
+
+	response, err := d.UpdateOccurrence(ctx.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	occurrence := response.GetOccurrence()
+
+	return ctx.JSON(newOccurrenceJSON(models.Occurrence{
+		EventID:      occurrence.GetEventId(),
+		RecurrenceID: occurrence.GetRecurrenceId().AsTime(),
+		Name:         occurrence.GetName(),
+		Timestamp:    occurrence.GetTimestamp().AsTime(),
+		UserIDs:      occurrence.GetUserIds(),
+		Modified:     occurrence.GetModified(),
+	}))
+}
+
+func (d *Delivery) cancelOccurrenceHandler(ctx *fiber.Ctx) error {
+	id, err := parseID(ctx)
+	if err != nil {
+		return err
+	}
+
+	recurrenceID, err := parseRecurrenceID(ctx)
+	if err != nil {
+		return err
+	}
+
+	request := &CancelOccurrenceRequest{EventId: id, RecurrenceId: recurrenceID}
+
+	err = d.validator.Validate(request)
+	if err != nil {
+		return err
+	}
+
+	event, err := d.useCase.CancelOccurrence(ctx.UserContext(), id, request.GetRecurrenceId().AsTime())
+	if err != nil {
+		return err
+	}
+
+	app.SetETag(ctx, event.Version)
+
+	return ctx.JSON(newEventJSON(event))
+}
+
+func sendCalendar(ctx *fiber.Ctx, events []models.CalendarEvent) error {
+	ctx.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+
+	return writeCalendar(ctx.Response().BodyWriter(), events, ctx.Hostname())
+}
+
+func (d *Delivery) exportEventHandler(ctx *fiber.Ctx) error {
+	id, err := parseID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = d.validator.Validate(&GetEventRequest{Id: id})
+	if err != nil {
+		return err
+	}
+
+	event, err := d.useCase.ExportEvent(ctx.UserContext(), id)
+	if err != nil {
+		return err
+	}
+
+	return sendCalendar(ctx, []models.CalendarEvent{event})
+}
+
+func (d *Delivery) exportUserEventsHandler(ctx *fiber.Ctx) error {
+	userID, err := parseUserID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = d.validator.Validate(&ListEventsRequest{UserId: &userID})
+	if err != nil {
+		return err
+	}
+
+	events, err := d.useCase.ExportEvents(ctx.UserContext(), models.EventFilter{UserIDs: []uint64{userID}})
+	if err != nil {
+		return err
+	}
+
+	return sendCalendar(ctx, events)
+}
+
+func (d *Delivery) importEventsHandler(ctx *fiber.Ctx) error {
+	var query importEventsQuery
+
+	err := ctx.QueryParser(&query)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	request := &ImportEventsRequest{
+		Calendar:       ctx.Body(),
+		MatchAttendees: query.MatchAttendees,
+	}
+
+	err = d.validator.Validate(request)
+	if err != nil {
+		return err
+	}
+
+	response, err := d.ImportEvents(ctx.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	unmatchedAttendees := response.GetUnmatchedAttendees()
+	if unmatchedAttendees == nil {
+		unmatchedAttendees = make([]string, 0)
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(importEventsJSON{
+		IDs:                response.GetIds(),
+		UnmatchedAttendees: unmatchedAttendees,
+	})
+}
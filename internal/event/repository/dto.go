@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"strings"
 	"time"
 
 	"github.com/Inspirate789/grpc-template/internal/models"
@@ -9,9 +10,68 @@ import (
 const TimestampLayout = time.RFC3339
 
 type EventDTO struct {
-	ID        uint64 `db:"id"`
-	Name      string `db:"name"`
-	Timestamp string `db:"timestamp"`
+	ID        uint64     `db:"id"`
+	Name      string     `db:"name"`
+	Timestamp string     `db:"timestamp"`
+	DeletedAt *time.Time `db:"deleted_at"`
+	Version   uint64     `db:"version"`
+	RRule     *string    `db:"rrule"`
+	TimeZone  *string    `db:"time_zone"`
+	// ExDates holds comma-separated start times of cancelled occurrences.
+	ExDates *string `db:"exdates"`
+}
+
+func newEventDTO(event models.Event) EventDTO {
+	dto := EventDTO{
+		ID:        event.ID,
+		Name:      event.Name,
+		Timestamp: event.Timestamp.UTC().Format(TimestampLayout),
+		DeletedAt: event.DeletedAt,
+		Version:   event.Version,
+		RRule:     nil,
+		TimeZone:  nil,
+		ExDates:   nil,
+	}
+
+	if event.Recurrence != nil {
+		exDates := make([]string, 0, len(event.Recurrence.ExDates))
+		for _, exDate := range event.Recurrence.ExDates {
+			exDates = append(exDates, exDate.UTC().Format(TimestampLayout))
+		}
+
+		dto.RRule = &event.Recurrence.RRule
+		dto.TimeZone = &event.Recurrence.TimeZone
+		dto.ExDates = new(string)
+		*dto.ExDates = strings.Join(exDates, ",")
+	}
+
+	return dto
+}
+
+// recurrence must be called for events with a rule only.
+func (dto EventDTO) recurrence() (*models.Recurrence, error) {
+	recurrence := &models.Recurrence{
+		RRule:    *dto.RRule,
+		TimeZone: "",
+		ExDates:  nil,
+	}
+
+	if dto.TimeZone != nil {
+		recurrence.TimeZone = *dto.TimeZone
+	}
+
+	if dto.ExDates != nil && *dto.ExDates != "" {
+		for _, value := range strings.Split(*dto.ExDates, ",") {
+			exDate, err := time.Parse(TimestampLayout, value)
+			if err != nil {
+				return nil, err
+			}
+
+			recurrence.ExDates = append(recurrence.ExDates, exDate)
+		}
+	}
+
+	return recurrence, nil
 }
 
 type EventUserDTO struct {
@@ -19,6 +79,11 @@ type EventUserDTO struct {
 	EventID uint64 `db:"event_id"`
 }
 
+type UserNameDTO struct {
+	ID   uint64 `db:"id"`
+	Name string `db:"name"`
+}
+
 type EventWithUsersDTO struct {
 	EventDTO
 	UserIDs []uint64 `db:"user_ids"`
@@ -30,50 +95,74 @@ func (dto EventWithUsersDTO) ToModel() (models.Event, error) {
 		return models.Event{}, err
 	}
 
-	return models.Event{
-		ID:        dto.ID,
-		Name:      dto.Name,
-		Timestamp: timestamp,
-		UserIDs:   dto.UserIDs,
-	}, nil
-}
-
-type CountedEventDTO struct {
-	EventWithUsersDTO
-	TotalCount uint64 `db:"total_count"`
-}
+	event := models.Event{
+		ID:         dto.ID,
+		Name:       dto.Name,
+		Timestamp:  timestamp,
+		UserIDs:    dto.UserIDs,
+		DeletedAt:  dto.DeletedAt,
+		Version:    dto.Version,
+		Recurrence: nil,
+	}
 
-func (dto CountedEventDTO) ToModel() (models.Event, error) {
-	timestamp, err := time.Parse(TimestampLayout, dto.Timestamp)
-	if err != nil {
-		return models.Event{}, err
+	if dto.RRule != nil {
+		event.Recurrence, err = dto.recurrence()
+		if err != nil {
+			return models.Event{}, err
+		}
 	}
 
-	return models.Event{
-		ID:        dto.ID,
-		Name:      dto.Name,
-		Timestamp: timestamp,
-		UserIDs:   dto.UserIDs,
-	}, nil
+	return event, nil
 }
 
-type EventsDTO []CountedEventDTO
+type EventsDTO []EventWithUsersDTO
 
-func (dto EventsDTO) ToModel() ([]models.Event, uint64, error) {
+func (dto EventsDTO) ToModel() ([]models.Event, error) {
 	res := make([]models.Event, 0, len(dto))
 
 	for _, event := range dto {
 		model, err := event.ToModel()
 		if err != nil {
-			return nil, 0, err
+			return nil, err
 		}
 
 		res = append(res, model)
 	}
 
-	if len(dto) != 0 {
-		return res, dto[0].TotalCount, nil
+	return res, nil
+}
+
+type OccurrenceDTO struct {
+	EventID      uint64 `db:"event_id"`
+	RecurrenceID string `db:"recurrence_id"`
+	Name         string `db:"name"`
+	Timestamp    string `db:"timestamp"`
+}
+
+func newOccurrenceDTO(override models.OccurrenceOverride) OccurrenceDTO {
+	return OccurrenceDTO{
+		EventID:      override.EventID,
+		RecurrenceID: override.RecurrenceID.UTC().Format(TimestampLayout),
+		Name:         override.Name,
+		Timestamp:    override.Timestamp.UTC().Format(TimestampLayout),
+	}
+}
+
+func (dto OccurrenceDTO) ToModel() (models.OccurrenceOverride, error) {
+	recurrenceID, err := time.Parse(TimestampLayout, dto.RecurrenceID)
+	if err != nil {
+		return models.OccurrenceOverride{}, err
 	}
 
-	return res, 0, nil
+	timestamp, err := time.Parse(TimestampLayout, dto.Timestamp)
+	if err != nil {
+		return models.OccurrenceOverride{}, err
+	}
+
+	return models.OccurrenceOverride{
+		EventID:      dto.EventID,
+		RecurrenceID: recurrenceID,
+		Name:         dto.Name,
+		Timestamp:    timestamp,
+	}, nil
 }
@@ -1,18 +1,133 @@
 package repository
 
+// eventsFilter selects events by models.EventFilter; its arguments are built by eventsFilterArgs.
+// Unset time bounds are replaced by the minimal and maximal timestamps and unset name patterns by "%".
+// Participants among the user ids are counted and compared with the required count, which is one for
+// UserMatchAny, the number of user ids for UserMatchAll and zero without the user filter.
+const eventsFilter = `
+    (? or e.deleted_at is null)
+    and e.timestamp >= ? and e.timestamp <= ?
+    and lower(e.name) like ? escape '\' and lower(e.name) like ? escape '\'
+    and (? = 0 or (
+        select count(*)
+        from users_and_events ue join users u on u.id = ue.user_id
+        where ue.event_id = e.id and ue.user_id in (?) and (? or u.deleted_at is null)
+    ) >= ?)`
+
+// Queries listing events take the arguments of eventsFilter followed by the ones of the page:
+// whether there is no cursor, the cursor values, limit and offset.
+const (
+	selectEventsByTimestampQuery = `/* select_events_by_timestamp */ select e.* from events e where ` + eventsFilter + `
+        and (? or (e.timestamp, e.id) > (?, ?))
+        order by e.timestamp, e.id
+        limit ? offset ?;`
+	selectEventsByTimestampDescQuery = `/* select_events_by_timestamp_desc */ select e.* from events e where ` + eventsFilter + `
+        and (? or (e.timestamp, e.id) < (?, ?))
+        order by e.timestamp desc, e.id desc
+        limit ? offset ?;`
+	selectEventsByNameQuery = `/* select_events_by_name */ select e.* from events e where ` + eventsFilter + `
+        and (? or (e.name, e.id) > (?, ?))
+        order by e.name, e.id
+        limit ? offset ?;`
+	selectEventsByIDQuery = `/* select_events_by_id */ select e.* from events e where ` + eventsFilter + `
+        and (? or e.id > ?)
+        order by e.id
+        limit ? offset ?;`
+	countEventsQuery = `/* count_events */ select count(*) from events e where ` + eventsFilter + `;`
+)
+
+// Soft-deleted events and participants are hidden unless the show_deleted argument is true.
+// Links to soft-deleted rows are kept, so restoring a user or an event brings them back.
 const (
-	selectEventQuery          = `select * from events where id = $1 limit 1;`
-	selectUserIDsByEventQuery = `select user_id from users_and_events ue where ue.event_id = $1;`
-	selectEventsQuery         = `select events.*, count(*) over () as total_count from events limit $1 offset $2;`
-	selectEventsByUserQuery   = `
-        select e.*, count(*) over () as total_count 
-        from events e join users_and_events ue on ue.user_id = $1 and e.id = ue.event_id
-        limit $2
-        offset $3;
-    `
-	insertEventQuery      = `insert into events(name, timestamp) values (:name, :timestamp) returning id;`
-	insertEventUserQuery  = `insert into users_and_events(user_id, event_id) values (:user_id, :event_id);`
-	updateEventQuery      = `update events set name = :name, timestamp = :timestamp where id = :id;`
-	deleteEventQuery      = `delete from events where id = $1;`
-	deleteEventUsersQuery = `delete from users_and_events where event_id = $1 and user_id in ($2);`
+	selectEventQuery          = `/* select_event */ select * from events where id = $1 and ($2 or deleted_at is null) limit 1;`
+	selectUserIDsByEventQuery = `
+        /* select_user_ids_by_event */
+        select ue.user_id
+        from users_and_events ue join users u on u.id = ue.user_id
+        where ue.event_id = $1 and ($2 or u.deleted_at is null)
+        order by ue.user_id;
+    `
+	selectEventsByIDsQuery     = `/* select_events_by_ids */ select * from events where id in (?) and (? or deleted_at is null);`
+	selectEventUsersByIDsQuery = `
+        /* select_event_users_by_ids */
+        select ue.user_id, ue.event_id
+        from users_and_events ue join users u on u.id = ue.user_id
+        where ue.event_id in (?) and (? or u.deleted_at is null)
+        order by ue.event_id, ue.user_id;
+    `
+	insertEventQuery = `
+        /* insert_event */
+        insert into events(name, timestamp, rrule, time_zone, exdates)
+        values (:name, :timestamp, :rrule, :time_zone, :exdates)
+        returning id;
+    `
+	// insertEventUserQuery inserts nothing if the user does not exist or is soft-deleted.
+	insertEventUserQuery = `
+        /* insert_event_user */
+        insert into users_and_events(user_id, event_id)
+        select id, cast(:event_id as bigint) from users where id = :user_id and deleted_at is null;
+    `
+	addEventUserQuery = `
+        /* add_event_user */
+        insert into users_and_events(user_id, event_id) values (:user_id, :event_id)
+        on conflict (user_id, event_id) do nothing;
+    `
+	selectActiveUserIDsQuery = `/* select_active_user_ids */ select id from users where id in (?) and deleted_at is null;`
+	// updateEventQuery is applied to the version read in the same transaction, so a concurrent
+	// change between the read and the update makes it match no rows.
+	updateEventQuery = `
+        /* update_event */
+        update events
+        set name = :name, timestamp = :timestamp, rrule = :rrule, time_zone = :time_zone, exdates = :exdates,
+            version = version + 1
+        where id = :id and version = :version and deleted_at is null;
+    `
+	// lockEventQuery changes nothing but locks the event row until the end of the transaction.
+	lockEventQuery          = `/* lock_event */ update events set version = version where id = $1;`
+	updateEventExDatesQuery = `/* update_event_exdates */ update events set exdates = $1, version = version + 1 where id = $2;`
+	bumpEventVersionQuery   = `/* bump_event_version */ update events set version = version + 1 where id = $1;`
+	// deleteEventQuery applies to the expected version only; zero matches any version.
+	deleteEventQuery = `
+        /* delete_event */
+        update events set deleted_at = $1, version = version + 1
+        where id = $2 and deleted_at is null and (version = $3 or $3 = 0);
+    `
+	deleteEventUsersQuery = `/* delete_event_users */ delete from users_and_events where event_id = ? and user_id in (?);`
+	deleteEventsQuery     = `/* delete_events */ update events set deleted_at = ?, version = version + 1 where id in (?);`
+	restoreEventQuery     = `/* restore_event */ update events set deleted_at = null, version = version + 1 where id = $1 and deleted_at is not null;`
+	// selectOccurrenceEventIDsQuery selects events that may have occurrences within [$4, $3]:
+	// recurring events starting before its end, the other events starting within it and events
+	// with an occurrence moved into it.
+	selectOccurrenceEventIDsQuery = `
+        /* select_occurrence_event_ids */
+        select e.id
+        from events e
+        where e.deleted_at is null
+            and (e.id = $1 or $1 = 0)
+            and (exists (select 1 from users_and_events ue where ue.event_id = e.id and ue.user_id = $2) or $2 = 0)
+            and (
+                e.timestamp <= $3 and (e.rrule is not null or e.timestamp >= $4)
+                or exists (
+                    select 1 from event_occurrences o where o.event_id = e.id and o.timestamp >= $4 and o.timestamp <= $3
+                )
+            );
+    `
+	selectOccurrencesByEventsQuery = `
+        /* select_occurrences_by_events */
+        select event_id, recurrence_id, name, timestamp from event_occurrences where event_id in (?);
+    `
+	upsertOccurrenceQuery = `
+        /* upsert_occurrence */
+        insert into event_occurrences(event_id, recurrence_id, name, timestamp)
+        values (:event_id, :recurrence_id, :name, :timestamp)
+        on conflict (event_id, recurrence_id) do update set name = excluded.name, timestamp = excluded.timestamp;
+    `
+	deleteOccurrenceQuery     = `/* delete_occurrence */ delete from event_occurrences where event_id = $1 and recurrence_id = $2;`
+	selectUserNamesByIDsQuery = `/* select_user_names_by_ids */ select id, name from users where id in (?);`
+	// selectActiveUsersByNamesQuery selects users to match attendees of imported events by name.
+	selectActiveUsersByNamesQuery = `
+        /* select_active_users_by_names */
+        select id, name from users where name in (?) and deleted_at is null;
+    `
+	purgeEventsQuery = `/* purge_events */ delete from events where deleted_at < $1;`
 )
@@ -11,18 +11,21 @@ import (
 	"time"
 
 	"github.com/Inspirate789/grpc-template/internal/models"
+	"github.com/Inspirate789/grpc-template/internal/pkg/idempotency"
 	"github.com/Inspirate789/grpc-template/pkg/sqlxutils"
 	"github.com/jmoiron/sqlx"
 )
 
 type SqlxRepository struct {
-	db     *sqlx.DB
+	db     *sqlxutils.DB
+	keys   *idempotency.Store
 	logger *slog.Logger
 }
 
-func NewSqlx(db *sqlx.DB, logger *slog.Logger) *SqlxRepository {
+func NewSqlx(db *sqlxutils.DB, keys *idempotency.Store, logger *slog.Logger) *SqlxRepository {
 	return &SqlxRepository{
 		db:     db,
+		keys:   keys,
 		logger: logger,
 	}
 }
@@ -31,33 +34,86 @@ func (r *SqlxRepository) HealthCheck(ctx context.Context) error {
 	return r.db.PingContext(ctx)
 }
 
-func (r *SqlxRepository) CreateEvent(ctx context.Context, name string, timestamp time.Time, userIDs []uint64) (uint64, error) {
-	dto := EventDTO{
-		ID:        0,
-		Name:      name,
-		Timestamp: timestamp.Format(TimestampLayout),
+// CreateEvent creates the event with its participants. A retried request with the same
+// idempotency key returns the id of the event created by the first one; created is false then.
+func (r *SqlxRepository) CreateEvent(ctx context.Context, event models.Event) (id uint64, created bool, err error) {
+	dto := EventWithUsersDTO{
+		EventDTO: newEventDTO(event),
+		UserIDs:  event.UserIDs,
 	}
 
-	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(tx *sqlx.Tx) error {
-		err := sqlxutils.NamedGet(ctx, tx, &dto.ID, insertEventQuery, dto)
-		if err != nil {
-			return err
-		}
+	err = sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		var err error
 
-		for _, userID := range userIDs {
-			_, err = sqlxutils.NamedExec(ctx, tx, insertEventUserQuery, EventUserDTO{
-				UserID:  userID,
-				EventID: dto.ID,
-			})
+		dto.ID, created, err = r.keys.Create(ctx, tx, models.EventResource, dto, func() (uint64, error) {
+			var id uint64
+
+			err := sqlxutils.NamedGet(ctx, tx, &id, insertEventQuery, dto.EventDTO)
 			if err != nil {
-				return err
+				return 0, err
 			}
+
+			for _, userID := range event.UserIDs {
+				err = insertEventUserTx(ctx, tx, userID, id)
+				if err != nil {
+					return 0, err
+				}
+			}
+
+			return id, nil
+		})
+
+		return err
+	})
+	if err != nil {
+		return 0, false, participantsErr(err)
+	}
+
+	return dto.ID, created, nil
+}
+
+// participantsErr translates constraint violations on event participants into domain errors.
+func participantsErr(err error) error {
+	switch {
+	case errors.Is(err, sqlxutils.ErrUniqueViolation):
+		return models.NewInvalidArgumentError(models.FieldViolation{
+			Field:       "user_ids",
+			Description: "user ids must be unique",
+		})
+	case errors.Is(err, sqlxutils.ErrForeignKeyViolation):
+		return &models.FailedPreconditionError{
+			Subject:     "user_ids",
+			Description: "referenced user does not exist",
+		}
+	case errors.Is(err, sqlxutils.ErrSerializationFailure):
+		return &models.ConflictError{
+			Resource:    models.EventResource,
+			Description: "concurrent modification, retry the request",
 		}
+	default:
+		return err
+	}
+}
 
-		return nil
+// insertEventUserTx links the user to the event. Soft-deleted users are reported
+// as violating the foreign key, like the ones that don't exist.
+func insertEventUserTx(ctx context.Context, tx sqlx.ExtContext, userID, eventID uint64) error {
+	res, err := sqlxutils.NamedExec(ctx, tx, insertEventUserQuery, EventUserDTO{
+		UserID:  userID,
+		EventID: eventID,
 	})
+	if err != nil {
+		return err
+	}
+
+	rowsCount, err := res.RowsAffected()
+	if err != nil {
+		return err
+	} else if rowsCount == 0 {
+		return sqlxutils.ErrForeignKeyViolation
+	}
 
-	return dto.ID, err
+	return nil
 }
 
 func (*SqlxRepository) updateEventUsersTx(
@@ -76,152 +132,1015 @@ func (*SqlxRepository) updateEventUsersTx(
 
 	for _, userID := range newUsers {
 		if !slices.Contains(oldUsers, userID) {
-			_, err := sqlxutils.NamedExec(ctx, tx, insertEventUserQuery, EventUserDTO{
-				UserID:  userID,
-				EventID: eventID,
-			})
+			err := insertEventUserTx(ctx, tx, userID, eventID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(old) == 0 {
+		return nil
+	}
+
+	query, args, err := sqlxutils.In(tx, deleteEventUsersQuery, eventID, old)
+	if err != nil {
+		return err
+	}
+
+	_, err = sqlxutils.Exec(ctx, tx, query, args...)
+
+	return err
+}
+
+func concurrentModificationErr(id uint64) error {
+	return &models.ConflictError{
+		Resource:    models.EventResource,
+		Name:        strconv.FormatUint(id, 10),
+		Description: "concurrent modification, retry the request",
+	}
+}
+
+// checkEvent calls check, if set, with the event locked by getEventForUpdateTx.
+func checkEvent(check models.EventCheck, event models.Event, removedUserIDs []uint64) error {
+	if check == nil {
+		return nil
+	}
+
+	return check(event, removedUserIDs)
+}
+
+// getEventForUpdateTx locks the event and loads it. Every change of an event or its participants starts
+// with it, so the event stays as checked by an EventCheck until the end of the transaction.
+func (r *SqlxRepository) getEventForUpdateTx(
+	ctx context.Context,
+	tx sqlx.ExtContext,
+	id uint64,
+	showDeleted bool,
+) (models.Event, error) {
+	_, err := sqlxutils.Exec(ctx, tx, lockEventQuery, id)
+	if err != nil {
+		return models.Event{}, err
+	}
+
+	return r.getEventTx(ctx, tx, id, showDeleted)
+}
+
+// UpdateEvent updates the fields of the event selected by mask and returns the updated event.
+// Participants are left alone unless user_ids is in the mask. If event.Version is set,
+// the event is updated only if its version matches.
+func (r *SqlxRepository) UpdateEvent(
+	ctx context.Context,
+	event models.Event,
+	mask models.FieldMask,
+	check models.EventCheck,
+) (models.Event, error) {
+	var updated models.Event
+
+	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		existingEvent, err := r.getEventForUpdateTx(ctx, tx, event.ID, false)
+		if err != nil {
+			return err
+		}
+
+		if event.Version != 0 && event.Version != existingEvent.Version {
+			return models.NewVersionMismatchError(models.EventResource, event.ID, event.Version, existingEvent.Version)
+		}
+
+		updated = existingEvent.Merge(event, mask)
+
+		removed := slices.DeleteFunc(slices.Clone(existingEvent.UserIDs), func(userID uint64) bool {
+			return slices.Contains(updated.UserIDs, userID)
+		})
+
+		err = checkEvent(check, existingEvent, removed)
+		if err != nil {
+			return err
+		}
+
+		if !slices.Equal(updated.UserIDs, existingEvent.UserIDs) {
+			err = r.updateEventUsersTx(ctx, tx, event.ID, existingEvent.UserIDs, updated.UserIDs)
+			if err != nil {
+				return err
+			}
+		}
+
+		if mask.Has(models.EventFieldTimestamp) || mask.Has(models.EventFieldRecurrence) {
+			err = r.deleteOrphanedOccurrencesTx(ctx, tx, updated)
 			if err != nil {
 				return err
 			}
 		}
+
+		res, err := sqlxutils.NamedExec(ctx, tx, updateEventQuery, newEventDTO(updated))
+		if err != nil {
+			return err
+		}
+
+		rowsCount, err := res.RowsAffected()
+		if err != nil {
+			return err
+		} else if rowsCount == 0 {
+			return concurrentModificationErr(event.ID)
+		}
+
+		updated.Version++
+
+		return nil
+	})
+	if err != nil {
+		return models.Event{}, participantsErr(err)
+	}
+
+	return updated, nil
+}
+
+// deleteOrphanedOccurrencesTx deletes the overrides of occurrences the event no longer has
+// after a change of its timestamp or recurrence.
+func (r *SqlxRepository) deleteOrphanedOccurrencesTx(ctx context.Context, tx *sqlxutils.Tx, event models.Event) error {
+	overrides, err := r.getOccurrenceOverridesTx(ctx, tx, []uint64{event.ID})
+	if err != nil {
+		return err
 	}
 
-	var err error
-	if len(old) != 0 {
-		arr := make([]string, 0, len(old))
-		for _, userID := range old {
-			arr = append(arr, strconv.FormatUint(userID, 10))
+	for _, override := range overrides {
+		ok, occurrenceErr := event.HasOccurrence(override.RecurrenceID)
+		if occurrenceErr != nil {
+			return occurrenceErr
+		} else if ok {
+			continue
+		}
+
+		_, err = sqlxutils.Exec(ctx, tx, deleteOccurrenceQuery, event.ID, override.RecurrenceID.UTC().Format(TimestampLayout))
+		if err != nil {
+			return err
 		}
+	}
+
+	return nil
+}
 
-		_, err = sqlxutils.Exec(ctx, tx, deleteEventUsersQuery, eventID, strings.Join(arr, ","))
+// bumpEventVersionTx increments the version of the event if its participants have changed.
+func bumpEventVersionTx(ctx context.Context, tx sqlx.ExecerContext, eventID uint64, changed int64) error {
+	if changed == 0 {
+		return nil
 	}
 
+	_, err := sqlxutils.Exec(ctx, tx, bumpEventVersionQuery, eventID)
+
 	return err
 }
 
-func (r *SqlxRepository) UpdateEvent(ctx context.Context, event models.Event) (found bool, err error) {
-	var res sql.Result
+// AddEventUsers adds participants to the event, skipping the existing ones, and returns the event.
+func (r *SqlxRepository) AddEventUsers(
+	ctx context.Context,
+	eventID uint64,
+	userIDs []uint64,
+	check models.EventCheck,
+) (models.Event, error) {
+	var event models.Event
+
+	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		existingEvent, err := r.getEventForUpdateTx(ctx, tx, eventID, false)
+		if err != nil {
+			return err
+		}
+
+		err = checkEvent(check, existingEvent, nil)
+		if err != nil {
+			return err
+		}
 
-	err = sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(tx *sqlx.Tx) error {
-		var existingEvent models.Event
-		existingEvent, found, err = r.getEventTx(ctx, tx, event.ID)
+		query, args, err := sqlxutils.In(tx, selectActiveUserIDsQuery, userIDs)
 		if err != nil {
 			return err
 		}
 
-		if !slices.Equal(event.UserIDs, existingEvent.UserIDs) {
-			err = r.updateEventUsersTx(ctx, tx, event.ID, existingEvent.UserIDs, event.UserIDs)
+		existing := make([]uint64, 0, len(userIDs))
+
+		err = sqlxutils.Select(ctx, tx, &existing, query, args...)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		if len(existing) != len(userIDs) {
+			return sqlxutils.ErrForeignKeyViolation
+		}
+
+		var added int64
+
+		for _, userID := range userIDs {
+			res, err := sqlxutils.NamedExec(ctx, tx, addEventUserQuery, EventUserDTO{
+				UserID:  userID,
+				EventID: eventID,
+			})
+			if err != nil {
+				return err
+			}
+
+			rowsCount, err := res.RowsAffected()
 			if err != nil {
 				return err
 			}
+
+			added += rowsCount
+		}
+
+		err = bumpEventVersionTx(ctx, tx, eventID, added)
+		if err != nil {
+			return err
 		}
 
-		dto := EventDTO{ID: event.ID, Name: event.Name, Timestamp: event.Timestamp.Format(TimestampLayout)}
-		res, err = sqlxutils.NamedExec(ctx, tx, updateEventQuery, dto)
+		event, err = r.getEventTx(ctx, tx, eventID, false)
 
 		return err
 	})
 	if err != nil {
-		return false, err
+		return models.Event{}, participantsErr(err)
 	}
 
-	rowsCount, err := res.RowsAffected()
+	return event, nil
+}
+
+// RemoveEventUsers removes participants from the event, skipping the ones that don't participate,
+// and returns the event.
+func (r *SqlxRepository) RemoveEventUsers(
+	ctx context.Context,
+	eventID uint64,
+	userIDs []uint64,
+	check models.EventCheck,
+) (models.Event, error) {
+	var event models.Event
+
+	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		existingEvent, err := r.getEventForUpdateTx(ctx, tx, eventID, false)
+		if err != nil {
+			return err
+		}
+
+		err = checkEvent(check, existingEvent, userIDs)
+		if err != nil {
+			return err
+		}
+
+		query, args, err := sqlxutils.In(tx, deleteEventUsersQuery, eventID, userIDs)
+		if err != nil {
+			return err
+		}
+
+		res, err := sqlxutils.Exec(ctx, tx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		removed, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		err = bumpEventVersionTx(ctx, tx, eventID, removed)
+		if err != nil {
+			return err
+		}
+
+		event, err = r.getEventTx(ctx, tx, eventID, false)
+
+		return err
+	})
 	if err != nil {
-		return false, err
+		return models.Event{}, participantsErr(err)
 	}
 
-	return rowsCount != 0, nil
+	return event, nil
 }
 
-func (r *SqlxRepository) DeleteEvent(ctx context.Context, id uint64) error {
-	_, err := sqlxutils.Exec(ctx, r.db, deleteEventQuery, id)
+// DeleteEvent soft-deletes the event if its version matches, unless version is zero,
+// keeping it and its participants until it is restored or purged. It returns the event as it was before.
+func (r *SqlxRepository) DeleteEvent(ctx context.Context, id, version uint64, check models.EventCheck) (models.Event, error) {
+	var event models.Event
 
-	return err
+	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		var err error
+
+		event, err = r.getEventForUpdateTx(ctx, tx, id, false)
+		if err != nil {
+			return err
+		} else if version != 0 && version != event.Version {
+			return models.NewVersionMismatchError(models.EventResource, id, version, event.Version)
+		}
+
+		err = checkEvent(check, event, nil)
+		if err != nil {
+			return err
+		}
+
+		_, err = sqlxutils.Exec(ctx, tx, deleteEventQuery, sqlxutils.Now(), id, version)
+
+		return err
+	})
+
+	return event, err
 }
 
-func (*SqlxRepository) getEventTx(ctx context.Context, tx sqlx.QueryerContext, id uint64) (models.Event, bool, error) {
+func (*SqlxRepository) getEventTx(ctx context.Context, tx sqlx.QueryerContext, id uint64, showDeleted bool) (models.Event, error) {
 	var dto EventWithUsersDTO
-	err := sqlxutils.Get(ctx, tx, &dto, selectEventQuery, id)
+	err := sqlxutils.Get(ctx, tx, &dto, selectEventQuery, id, showDeleted)
 	if errors.Is(err, sql.ErrNoRows) {
-		return models.Event{}, false, nil
+		return models.Event{}, models.NewNotFoundError(models.EventResource, id)
 	} else if err != nil {
-		return models.Event{}, false, err
+		return models.Event{}, err
 	}
 
-	err = sqlxutils.Select(ctx, tx, &dto.UserIDs, selectUserIDsByEventQuery, id)
+	err = sqlxutils.Select(ctx, tx, &dto.UserIDs, selectUserIDsByEventQuery, id, showDeleted)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return models.Event{}, false, err
+		return models.Event{}, err
 	}
 
-	model, err := dto.ToModel()
-
-	return model, true, err
+	return dto.ToModel()
 }
 
-func (r *SqlxRepository) GetEvent(ctx context.Context, id uint64) (models.Event, bool, error) {
-	var (
-		event models.Event
-		found bool
-	)
-	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(tx *sqlx.Tx) error {
+func (r *SqlxRepository) GetEvent(ctx context.Context, id uint64, showDeleted bool) (models.Event, error) {
+	var event models.Event
+
+	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
 		var txErr error
-		event, found, txErr = r.getEventTx(ctx, tx, id)
+		event, txErr = r.getEventTx(ctx, tx, id, showDeleted)
 		return txErr
 	})
 
-	return event, found, err
+	return event, err
 }
 
-func (r *SqlxRepository) GetEvents(ctx context.Context, limit, offset uint64) ([]models.Event, uint64, error) {
-	res := make(EventsDTO, 0)
+// RestoreEvent undoes the soft deletion of the event and returns it with its participants.
+func (r *SqlxRepository) RestoreEvent(ctx context.Context, id uint64, check models.EventCheck) (models.Event, error) {
+	var event models.Event
 
-	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(tx *sqlx.Tx) error {
-		txErr := sqlxutils.Select(ctx, tx, &res, selectEventsQuery, limit, offset)
-		if errors.Is(txErr, sql.ErrNoRows) {
-			return nil
-		} else if txErr != nil {
-			return txErr
+	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		existingEvent, err := r.getEventForUpdateTx(ctx, tx, id, true)
+		if err != nil {
+			return err
 		}
 
-		for i, dto := range res {
-			txErr = sqlxutils.Select(ctx, tx, &res[i].UserIDs, selectUserIDsByEventQuery, dto.ID)
-			if txErr != nil && !errors.Is(txErr, sql.ErrNoRows) {
-				return txErr
-			}
+		err = checkEvent(check, existingEvent, nil)
+		if err != nil {
+			return err
+		}
+
+		res, err := sqlxutils.Exec(ctx, tx, restoreEventQuery, id)
+		if err != nil {
+			return err
+		}
+
+		rowsCount, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		event, err = r.getEventTx(ctx, tx, id, true)
+		if err != nil {
+			return err
+		} else if rowsCount == 0 {
+			return &models.FailedPreconditionError{Subject: "id", Description: "event is not deleted"}
 		}
 
 		return nil
 	})
+
+	return event, err
+}
+
+// PurgeEvents hard-deletes events soft-deleted before the given time along with their participant links.
+func (r *SqlxRepository) PurgeEvents(ctx context.Context, before time.Time) (int64, error) {
+	res, err := sqlxutils.Exec(ctx, r.db, purgeEventsQuery, before.UTC())
 	if err != nil {
-		return nil, 0, err
+		return 0, err
 	}
 
-	return res.ToModel()
+	return res.RowsAffected()
 }
 
-func (r *SqlxRepository) GetEventsByUser(ctx context.Context, userID, limit, offset uint64) ([]models.Event, uint64, error) {
-	res := make(EventsDTO, 0)
+var (
+	minTimestamp = time.Date(1, time.January, 1, 0, 0, 0, 0, time.UTC)
+	maxTimestamp = time.Date(9999, time.December, 31, 23, 59, 59, 0, time.UTC)
+)
 
-	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(tx *sqlx.Tx) error {
-		txErr := sqlxutils.Select(ctx, tx, &res, selectEventsByUserQuery, userID, limit, offset)
-		if errors.Is(txErr, sql.ErrNoRows) {
-			return nil
-		} else if txErr != nil {
-			return txErr
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// eventsFilterArgs returns the arguments of eventsFilter.
+func eventsFilterArgs(filter models.EventFilter, showDeleted bool) []any {
+	from, to := minTimestamp, maxTimestamp
+	if filter.From != nil {
+		from = filter.From.UTC()
+	}
+
+	if filter.To != nil {
+		to = filter.To.UTC()
+	}
+
+	userIDs := slices.Compact(slices.Sorted(slices.Values(filter.UserIDs)))
+
+	var required int
+
+	switch {
+	case len(userIDs) == 0:
+		// The ids are only expanded into the query, no user has id 0.
+		userIDs = []uint64{0}
+	case filter.UserMatch == models.UserMatchAll:
+		required = len(userIDs)
+	default:
+		required = 1
+	}
+
+	return []any{
+		showDeleted,
+		from.Format(TimestampLayout),
+		to.Format(TimestampLayout),
+		likeEscaper.Replace(strings.ToLower(filter.NamePrefix)) + "%",
+		"%" + likeEscaper.Replace(strings.ToLower(filter.NameContains)) + "%",
+		required,
+		userIDs,
+		showDeleted,
+		required,
+	}
+}
+
+// selectEventsQuery returns the query listing events in the given order along with its cursor arguments.
+func selectEventsQuery(order models.EventOrder, after models.Cursor) (string, []any) {
+	noCursor := after.ID == 0
+
+	switch order {
+	case models.EventOrderTimestampDesc:
+		return selectEventsByTimestampDescQuery, []any{noCursor, after.Timestamp.Format(TimestampLayout), after.ID}
+	case models.EventOrderName:
+		return selectEventsByNameQuery, []any{noCursor, after.Name, after.ID}
+	case models.EventOrderID:
+		return selectEventsByIDQuery, []any{noCursor, after.ID}
+	default:
+		return selectEventsByTimestampQuery, []any{noCursor, after.Timestamp.Format(TimestampLayout), after.ID}
+	}
+}
+
+// eventsBatchSize limits the number of events whose participants are selected in one query,
+// keeping it within the bind variable limits of the drivers.
+const eventsBatchSize = 1000
+
+// selectEventUsersTx fills the participants of events with one query per eventsBatchSize events.
+func selectEventUsersTx(ctx context.Context, tx sqlx.ExtContext, events EventsDTO, showDeleted bool) error {
+	ids := make([]uint64, 0, len(events))
+	for _, dto := range events {
+		ids = append(ids, dto.ID)
+	}
+
+	userIDs := make(map[uint64][]uint64, len(events))
+
+	for batch := range slices.Chunk(ids, eventsBatchSize) {
+		query, args, err := sqlxutils.In(tx, selectEventUsersByIDsQuery, batch, showDeleted)
+		if err != nil {
+			return err
 		}
 
-		for i, dto := range res {
-			txErr = sqlxutils.Select(ctx, tx, &res[i].UserIDs, selectUserIDsByEventQuery, dto.ID)
-			if txErr != nil && !errors.Is(txErr, sql.ErrNoRows) {
-				return txErr
-			}
+		links := make([]EventUserDTO, 0)
+
+		err = sqlxutils.Select(ctx, tx, &links, query, args...)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
 		}
 
-		return nil
-	})
-	if err != nil {
-		return nil, 0, err
+		for _, link := range links {
+			userIDs[link.EventID] = append(userIDs[link.EventID], link.UserID)
+		}
 	}
 
-	return res.ToModel()
+	for i, dto := range events {
+		events[i].UserIDs = userIDs[dto.ID]
+	}
+
+	return nil
+}
+
+func (*SqlxRepository) getEventsTx(
+	ctx context.Context,
+	tx sqlx.ExtContext,
+	filter models.EventFilter,
+	page models.Page,
+) ([]models.Event, uint64, error) {
+	filterArgs := eventsFilterArgs(filter, page.ShowDeleted)
+	selectQuery, cursorArgs := selectEventsQuery(filter.Order, page.After)
+
+	query, args, err := sqlxutils.In(tx, selectQuery, slices.Concat(filterArgs, cursorArgs, []any{page.Limit, page.Offset})...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res := make(EventsDTO, 0)
+
+	err = sqlxutils.Select(ctx, tx, &res, query, args...)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, 0, err
+	}
+
+	err = selectEventUsersTx(ctx, tx, res, page.ShowDeleted)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var totalCount uint64
+
+	if page.WithTotalCount {
+		query, args, err = sqlxutils.In(tx, countEventsQuery, filterArgs...)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		err = sqlxutils.Get(ctx, tx, &totalCount, query, args...)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	events, err := res.ToModel()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return events, totalCount, nil
+}
+
+func (r *SqlxRepository) GetEvents(ctx context.Context, filter models.EventFilter, page models.Page) ([]models.Event, uint64, error) {
+	var (
+		events     []models.Event
+		totalCount uint64
+	)
+
+	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		var txErr error
+		events, totalCount, txErr = r.getEventsTx(ctx, tx, filter, page)
+		return txErr
+	})
+
+	return events, totalCount, err
+}
+
+func (*SqlxRepository) getEventsByIDsTx(
+	ctx context.Context,
+	tx sqlx.ExtContext,
+	ids []uint64,
+	showDeleted bool,
+) ([]models.Event, error) {
+	query, args, err := sqlxutils.In(tx, selectEventsByIDsQuery, ids, showDeleted)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(EventsDTO, 0, len(ids))
+
+	err = sqlxutils.Select(ctx, tx, &res, query, args...)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	err = selectEventUsersTx(ctx, tx, res, showDeleted)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.ToModel()
+}
+
+// GetEventsByIDs returns the existing events among ids in no particular order.
+func (r *SqlxRepository) GetEventsByIDs(ctx context.Context, ids []uint64, showDeleted bool) ([]models.Event, error) {
+	var events []models.Event
+
+	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		var txErr error
+		events, txErr = r.getEventsByIDsTx(ctx, tx, ids, showDeleted)
+		return txErr
+	})
+
+	return events, err
+}
+
+// DeleteEvents soft-deletes events in one transaction and returns the deleted ones.
+// In atomic mode a missing id fails the whole batch; in best-effort mode it is
+// reported in the result of its item.
+func (r *SqlxRepository) DeleteEvents(
+	ctx context.Context,
+	ids []uint64,
+	mode models.BatchMode,
+) ([]models.Event, []models.BatchResult, error) {
+	var (
+		events  []models.Event
+		results []models.BatchResult
+	)
+
+	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		existing, err := r.getEventsByIDsTx(ctx, tx, ids, false)
+		if err != nil {
+			return err
+		}
+
+		var missing []uint64
+
+		events, missing = models.OrderByIDs(ids, existing, func(event models.Event) uint64 { return event.ID })
+		if len(missing) != 0 && mode == models.BatchAtomic {
+			return models.NewNotFoundError(models.EventResource, missing[0])
+		}
+
+		results = make([]models.BatchResult, 0, len(ids))
+		for _, id := range ids {
+			result := models.BatchResult{ID: id, Err: nil}
+			if slices.Contains(missing, id) {
+				result.Err = models.NewNotFoundError(models.EventResource, id)
+			}
+
+			results = append(results, result)
+		}
+
+		if len(events) == 0 {
+			return nil
+		}
+
+		deleted := make([]uint64, 0, len(events))
+		for _, event := range events {
+			deleted = append(deleted, event.ID)
+		}
+
+		query, args, err := sqlxutils.In(tx, deleteEventsQuery, sqlxutils.Now(), deleted)
+		if err != nil {
+			return err
+		}
+
+		_, err = sqlxutils.Exec(ctx, tx, query, args...)
+
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return events, results, nil
+}
+
+func (*SqlxRepository) getOccurrenceOverridesTx(
+	ctx context.Context,
+	tx sqlx.ExtContext,
+	eventIDs []uint64,
+) ([]models.OccurrenceOverride, error) {
+	query, args, err := sqlxutils.In(tx, selectOccurrencesByEventsQuery, eventIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]OccurrenceDTO, 0)
+
+	err = sqlxutils.Select(ctx, tx, &res, query, args...)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	overrides := make([]models.OccurrenceOverride, 0, len(res))
+
+	for _, dto := range res {
+		override, err := dto.ToModel()
+		if err != nil {
+			return nil, err
+		}
+
+		overrides = append(overrides, override)
+	}
+
+	return overrides, nil
+}
+
+// GetOccurrenceEvents returns the events that may have occurrences matching the filter
+// along with the overrides of their occurrences.
+func (r *SqlxRepository) GetOccurrenceEvents(
+	ctx context.Context,
+	filter models.OccurrenceFilter,
+) ([]models.Event, []models.OccurrenceOverride, error) {
+	var (
+		events    []models.Event
+		overrides []models.OccurrenceOverride
+	)
+
+	var eventID, userID uint64
+	if filter.EventID != nil {
+		eventID = *filter.EventID
+	}
+
+	if filter.UserID != nil {
+		userID = *filter.UserID
+	}
+
+	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		ids := make([]uint64, 0)
+
+		err := sqlxutils.Select(ctx, tx, &ids, selectOccurrenceEventIDsQuery,
+			eventID, userID, filter.To.UTC().Format(TimestampLayout), filter.From.UTC().Format(TimestampLayout))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		events, err = r.getEventsByIDsTx(ctx, tx, ids, false)
+		if err != nil {
+			return err
+		}
+
+		overrides, err = r.getOccurrenceOverridesTx(ctx, tx, ids)
+
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return events, overrides, nil
+}
+
+func errNoOccurrence(id uint64) error {
+	return &models.FailedPreconditionError{
+		Subject:     "recurrence_id",
+		Description: "event " + strconv.FormatUint(id, 10) + " has no occurrence starting at recurrence_id",
+	}
+}
+
+// UpdateOccurrence changes a single occurrence of a recurring event and returns the event.
+func (r *SqlxRepository) UpdateOccurrence(
+	ctx context.Context,
+	override models.OccurrenceOverride,
+	check models.EventCheck,
+) (models.Event, error) {
+	var event models.Event
+
+	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		var err error
+
+		event, err = r.getEventForUpdateTx(ctx, tx, override.EventID, false)
+		if err != nil {
+			return err
+		}
+
+		err = checkEvent(check, event, nil)
+		if err != nil {
+			return err
+		}
+
+		ok, err := event.HasOccurrence(override.RecurrenceID)
+		if err != nil {
+			return err
+		} else if !ok {
+			return errNoOccurrence(event.ID)
+		}
+
+		_, err = sqlxutils.NamedExec(ctx, tx, upsertOccurrenceQuery, newOccurrenceDTO(override))
+		if err != nil {
+			return err
+		}
+
+		event.Version++
+
+		return bumpEventVersionTx(ctx, tx, event.ID, 1)
+	})
+
+	return event, err
+}
+
+// CancelOccurrence excludes a single occurrence from a recurring event and returns the event.
+func (r *SqlxRepository) CancelOccurrence(
+	ctx context.Context,
+	eventID uint64,
+	recurrenceID time.Time,
+	check models.EventCheck,
+) (models.Event, error) {
+	var event models.Event
+
+	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		var err error
+
+		event, err = r.getEventForUpdateTx(ctx, tx, eventID, false)
+		if err != nil {
+			return err
+		}
+
+		err = checkEvent(check, event, nil)
+		if err != nil {
+			return err
+		}
+
+		ok, err := event.HasOccurrence(recurrenceID)
+		if err != nil {
+			return err
+		} else if !ok {
+			return errNoOccurrence(eventID)
+		}
+
+		event.Recurrence.ExDates = append(event.Recurrence.ExDates, recurrenceID)
+		event.Version++
+
+		_, err = sqlxutils.Exec(ctx, tx, updateEventExDatesQuery, newEventDTO(event).ExDates, eventID)
+		if err != nil {
+			return err
+		}
+
+		_, err = sqlxutils.Exec(ctx, tx, deleteOccurrenceQuery, eventID, recurrenceID.UTC().Format(TimestampLayout))
+
+		return err
+	})
+
+	return event, err
+}
+
+func getUserNamesTx(ctx context.Context, tx sqlx.ExtContext, query string, args ...any) ([]UserNameDTO, error) {
+	query, args, err := sqlxutils.In(tx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]UserNameDTO, 0)
+
+	err = sqlxutils.Select(ctx, tx, &res, query, args...)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// GetCalendarEvents adds the names of the participants and the overrides of occurrences to events.
+func (r *SqlxRepository) GetCalendarEvents(ctx context.Context, events []models.Event) ([]models.CalendarEvent, error) {
+	res := make([]models.CalendarEvent, 0, len(events))
+	if len(events) == 0 {
+		return res, nil
+	}
+
+	eventIDs := make([]uint64, 0, len(events))
+	userIDs := make([]uint64, 0)
+
+	for _, event := range events {
+		eventIDs = append(eventIDs, event.ID)
+		userIDs = append(userIDs, event.UserIDs...)
+	}
+
+	var (
+		overrides []models.OccurrenceOverride
+		users     []UserNameDTO
+	)
+
+	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		var err error
+
+		overrides, err = r.getOccurrenceOverridesTx(ctx, tx, eventIDs)
+		if err != nil || len(userIDs) == 0 {
+			return err
+		}
+
+		users, err = getUserNamesTx(ctx, tx, selectUserNamesByIDsQuery, slices.Compact(slices.Sorted(slices.Values(userIDs))))
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[uint64]string, len(users))
+	for _, user := range users {
+		names[user.ID] = user.Name
+	}
+
+	for _, event := range events {
+		calendarEvent := models.CalendarEvent{
+			Event:     event,
+			Attendees: make([]string, 0, len(event.UserIDs)),
+			Overrides: make([]models.OccurrenceOverride, 0),
+		}
+
+		for _, userID := range event.UserIDs {
+			calendarEvent.Attendees = append(calendarEvent.Attendees, names[userID])
+		}
+
+		for _, override := range overrides {
+			if override.EventID == event.ID {
+				calendarEvent.Overrides = append(calendarEvent.Overrides, override)
+			}
+		}
+
+		res = append(res, calendarEvent)
+	}
+
+	return res, nil
+}
+
+// matchAttendeesTx returns the ids of the active users by their names, skipping names of several users.
+func matchAttendeesTx(ctx context.Context, tx sqlx.ExtContext, events []models.CalendarEvent) (map[string]uint64, error) {
+	names := make([]string, 0)
+	for _, event := range events {
+		names = append(names, event.Attendees...)
+	}
+
+	res := make(map[string]uint64)
+	if len(names) == 0 {
+		return res, nil
+	}
+
+	users, err := getUserNamesTx(ctx, tx, selectActiveUsersByNamesQuery, slices.Compact(slices.Sorted(slices.Values(names))))
+	if err != nil {
+		return nil, err
+	}
+
+	ambiguous := make(map[string]bool)
+
+	for _, user := range users {
+		if _, ok := res[user.Name]; ok {
+			ambiguous[user.Name] = true
+		}
+
+		res[user.Name] = user.ID
+	}
+
+	for name := range ambiguous {
+		delete(res, name)
+	}
+
+	return res, nil
+}
+
+// ImportEvents creates events along with the overrides of their occurrences in one transaction.
+// If matchAttendees is set, the users named by the attendees become participants as well.
+func (r *SqlxRepository) ImportEvents(
+	ctx context.Context,
+	events []models.CalendarEvent,
+	matchAttendees bool,
+) (models.CalendarImport, error) {
+	var res models.CalendarImport
+
+	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		res = models.CalendarImport{
+			Events:             make([]models.Event, 0, len(events)),
+			UnmatchedAttendees: make([]string, 0),
+		}
+
+		userIDsByName := make(map[string]uint64)
+
+		if matchAttendees {
+			var err error
+
+			userIDsByName, err = matchAttendeesTx(ctx, tx, events)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, calendarEvent := range events {
+			event := calendarEvent.Event
+			event.UserIDs = slices.Clone(event.UserIDs)
+
+			for _, name := range calendarEvent.Attendees {
+				userID, ok := userIDsByName[name]
+				if ok {
+					event.UserIDs = append(event.UserIDs, userID)
+				} else if matchAttendees {
+					res.UnmatchedAttendees = append(res.UnmatchedAttendees, name)
+				}
+			}
+
+			event.UserIDs = slices.Compact(slices.Sorted(slices.Values(event.UserIDs)))
+
+			err := sqlxutils.NamedGet(ctx, tx, &event.ID, insertEventQuery, newEventDTO(event))
+			if err != nil {
+				return err
+			}
+
+			for _, userID := range event.UserIDs {
+				err = insertEventUserTx(ctx, tx, userID, event.ID)
+				if err != nil {
+					return err
+				}
+			}
+
+			for _, override := range calendarEvent.Overrides {
+				override.EventID = event.ID
+
+				_, err = sqlxutils.NamedExec(ctx, tx, upsertOccurrenceQuery, newOccurrenceDTO(override))
+				if err != nil {
+					return err
+				}
+			}
+
+			event.Version = 1
+			res.Events = append(res.Events, event)
+		}
+
+		res.UnmatchedAttendees = slices.Compact(slices.Sorted(slices.Values(res.UnmatchedAttendees)))
+
+		return nil
+	})
+	if err != nil {
+		return models.CalendarImport{}, participantsErr(err)
+	}
+
+	return res, nil
 }
@@ -0,0 +1,413 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Inspirate789/grpc-template/internal/event/repository"
+	"github.com/Inspirate789/grpc-template/internal/models"
+	"github.com/Inspirate789/grpc-template/internal/pkg/dbtest"
+	"github.com/Inspirate789/grpc-template/internal/pkg/idempotency"
+	"github.com/Inspirate789/grpc-template/pkg/sqlxutils"
+)
+
+const (
+	insertUserQuery      = `/* insert_test_user */ insert into users(name) values ($1);`
+	insertEventQuery     = `/* insert_test_event */ insert into events(name, timestamp) values ($1, $2);`
+	insertEventUserQuery = `/* insert_test_event_user */ insert into users_and_events(user_id, event_id) values ($1, $2);`
+)
+
+// The dataset of BenchmarkGetEvents: every event has benchmarkParticipants of benchmarkUsers.
+const (
+	benchmarkUsers        = 1000
+	benchmarkEvents       = 5000
+	benchmarkParticipants = 20
+	benchmarkPageLimit    = 1000
+)
+
+func newRepository(db *sqlxutils.DB) *repository.SqlxRepository {
+	return repository.NewSqlx(db, idempotency.NewStore(db, idempotency.Config{}), slog.New(slog.DiscardHandler))
+}
+
+func insertUsers(ctx context.Context, tb testing.TB, db *sqlxutils.DB, count int) {
+	tb.Helper()
+
+	for range count {
+		_, err := sqlxutils.Exec(ctx, db, insertUserQuery, "user")
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+// insertEvents inserts events with participants picked in turn among count users in one transaction.
+func insertEvents(ctx context.Context, tb testing.TB, db *sqlxutils.DB, count, participants, users int) {
+	tb.Helper()
+
+	start := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	err := sqlxutils.RunTx(ctx, db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		for i := range count {
+			timestamp := start.Add(time.Duration(i) * time.Minute).Format(repository.TimestampLayout)
+
+			_, err := sqlxutils.Exec(ctx, tx, insertEventQuery, "event", timestamp)
+			if err != nil {
+				return err
+			}
+
+			for j := range participants {
+				_, err = sqlxutils.Exec(ctx, tx, insertEventUserQuery, (i*participants+j)%users+1, i+1)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func createEvent(ctx context.Context, tb testing.TB, repo *repository.SqlxRepository, event models.Event) uint64 {
+	tb.Helper()
+
+	id, _, err := repo.CreateEvent(ctx, event)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return id
+}
+
+func eventIDs(events []models.Event) []uint64 {
+	ids := make([]uint64, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+
+	return ids
+}
+
+func TestEventTimestamps(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *sqlxutils.DB) {
+		repo := newRepository(db)
+		zone := time.FixedZone("UTC+3", int((3 * time.Hour).Seconds()))
+		start := time.Date(2025, time.January, 1, 10, 0, 0, 0, time.UTC)
+
+		ids := make([]uint64, 0)
+		for i := range 3 {
+			timestamp := start.Add(time.Duration(i) * time.Hour).In(zone)
+			ids = append(ids, createEvent(t.Context(), t, repo, models.Event{Name: "event", Timestamp: timestamp}))
+		}
+
+		event, err := repo.GetEvent(t.Context(), ids[1], false)
+		if err != nil {
+			t.Fatal(err)
+		} else if want := start.Add(time.Hour); !event.Timestamp.Equal(want) {
+			t.Fatalf("got timestamp %v, want %v", event.Timestamp, want)
+		}
+
+		from, to := start.Add(time.Hour).In(zone), start.Add(2*time.Hour)
+		filter := models.EventFilter{From: &from, To: &to, Order: models.EventOrderTimestampDesc}
+
+		events, total, err := repo.GetEvents(t.Context(), filter, models.Page{Limit: 10, WithTotalCount: true})
+		if err != nil {
+			t.Fatal(err)
+		} else if want := []uint64{ids[2], ids[1]}; !slices.Equal(eventIDs(events), want) || total != 2 {
+			t.Fatalf("got events %v of %d within [%v, %v], want %v", eventIDs(events), total, from, to, want)
+		}
+	})
+}
+
+func TestGetEventsPages(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *sqlxutils.DB) {
+		repo := newRepository(db)
+		start := time.Date(2025, time.January, 1, 10, 0, 0, 0, time.UTC)
+
+		// Timestamps and names repeat, so pages must be split by the id as well.
+		for i := range 10 {
+			event := models.Event{Name: "event " + strconv.Itoa(i%4), Timestamp: start.Add(time.Duration(i%3) * time.Hour)}
+			createEvent(t.Context(), t, repo, event)
+		}
+
+		orders := []models.EventOrder{
+			models.EventOrderTimestamp, models.EventOrderTimestampDesc, models.EventOrderName, models.EventOrderID,
+		}
+
+		for _, order := range orders {
+			filter := models.EventFilter{Order: order}
+
+			all, _, err := repo.GetEvents(t.Context(), filter, models.Page{Limit: 100})
+			if err != nil {
+				t.Fatal(err)
+			} else if len(all) != 10 {
+				t.Fatalf("got %d events ordered by %v, want 10", len(all), order)
+			}
+
+			paged := make([]models.Event, 0, len(all))
+			page := models.Page{Limit: 3}
+
+			for {
+				events, _, pageErr := repo.GetEvents(t.Context(), filter, page)
+				if pageErr != nil {
+					t.Fatal(pageErr)
+				}
+
+				paged = append(paged, events...)
+				if uint64(len(events)) < page.Limit {
+					break
+				}
+
+				last := events[len(events)-1]
+				page.After = models.Cursor{ID: last.ID, Timestamp: last.Timestamp, Name: last.Name}
+			}
+
+			if !slices.Equal(eventIDs(paged), eventIDs(all)) {
+				t.Fatalf("got events %v over pages ordered by %v, want %v", eventIDs(paged), order, eventIDs(all))
+			}
+		}
+	})
+}
+
+func TestCreateEventIdempotencyKey(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *sqlxutils.DB) {
+		repo := newRepository(db)
+		ctx := idempotency.WithKey(t.Context(), "key")
+		event := models.Event{Name: "event", Timestamp: time.Now()}
+
+		id, created, err := repo.CreateEvent(ctx, event)
+		if err != nil {
+			t.Fatal(err)
+		} else if !created {
+			t.Fatal("got a replay for the first request")
+		}
+
+		retried, created, err := repo.CreateEvent(ctx, event)
+		if err != nil {
+			t.Fatal(err)
+		} else if created || retried != id {
+			t.Fatalf("got id %d, created %t for the retried request, want id %d replayed", retried, created, id)
+		}
+	})
+}
+
+func TestAddEventUsersConflict(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *sqlxutils.DB) {
+		repo := newRepository(db)
+		insertUsers(t.Context(), t, db, 3)
+
+		id := createEvent(t.Context(), t, repo, models.Event{Name: "event", Timestamp: time.Now(), UserIDs: []uint64{2}})
+
+		event, err := repo.AddEventUsers(t.Context(), id, []uint64{3, 1, 2}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if want := []uint64{1, 2, 3}; !slices.Equal(slices.Sorted(slices.Values(event.UserIDs)), want) {
+			t.Fatalf("got participants %v, want %v", event.UserIDs, want)
+		} else if event.Version != 2 {
+			t.Fatalf("got version %d after adding participants, want 2", event.Version)
+		}
+
+		event, err = repo.AddEventUsers(t.Context(), id, []uint64{1, 2}, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if event.Version != 2 {
+			t.Fatalf("got version %d after adding existing participants, want 2", event.Version)
+		}
+	})
+}
+
+func TestUpdateOccurrenceConflict(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *sqlxutils.DB) {
+		repo := newRepository(db)
+		start := time.Date(2025, time.January, 1, 10, 0, 0, 0, time.UTC)
+
+		event := models.Event{
+			Name:       "daily",
+			Timestamp:  start,
+			Recurrence: &models.Recurrence{RRule: "FREQ=DAILY;COUNT=3", TimeZone: "Europe/Berlin"},
+		}
+		event.ID = createEvent(t.Context(), t, repo, event)
+
+		override := models.OccurrenceOverride{
+			EventID:      event.ID,
+			RecurrenceID: start.AddDate(0, 0, 1),
+			Name:         "moved",
+			Timestamp:    start.AddDate(0, 0, 1).Add(time.Hour),
+		}
+
+		for _, name := range []string{"moved", "moved again"} {
+			override.Name = name
+
+			_, err := repo.UpdateOccurrence(t.Context(), override, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		event, err := repo.GetEvent(t.Context(), event.ID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		calendarEvents, err := repo.GetCalendarEvents(t.Context(), []models.Event{event})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		overrides := calendarEvents[0].Overrides
+		if len(overrides) != 1 || overrides[0].Name != "moved again" ||
+			!overrides[0].RecurrenceID.Equal(override.RecurrenceID) || !overrides[0].Timestamp.Equal(override.Timestamp) {
+			t.Fatalf("got overrides %+v, want the last one of %+v", overrides, override)
+		}
+	})
+}
+
+func TestUpdateEventOrphanedOccurrences(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *sqlxutils.DB) {
+		repo := newRepository(db)
+		start := time.Date(2025, time.January, 1, 10, 0, 0, 0, time.UTC)
+
+		event := models.Event{
+			Name:       "daily",
+			Timestamp:  start,
+			Recurrence: &models.Recurrence{RRule: "FREQ=DAILY;COUNT=3"},
+		}
+		event.ID = createEvent(t.Context(), t, repo, event)
+
+		for day := 1; day <= 2; day++ {
+			recurrenceID := start.AddDate(0, 0, day)
+			override := models.OccurrenceOverride{EventID: event.ID, RecurrenceID: recurrenceID, Name: "moved", Timestamp: recurrenceID}
+
+			_, err := repo.UpdateOccurrence(t.Context(), override, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		event.Recurrence = &models.Recurrence{RRule: "FREQ=DAILY;COUNT=2"}
+
+		event, err := repo.UpdateEvent(t.Context(), event, models.FieldMask{models.EventFieldRecurrence}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		calendarEvents, err := repo.GetCalendarEvents(t.Context(), []models.Event{event})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		overrides := calendarEvents[0].Overrides
+		if want := start.AddDate(0, 0, 1); len(overrides) != 1 || !overrides[0].RecurrenceID.Equal(want) {
+			t.Fatalf("got overrides %+v, want only the one of %v", overrides, want)
+		}
+	})
+}
+
+func TestGetOccurrenceEventsMovedIntoWindow(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *sqlxutils.DB) {
+		repo := newRepository(db)
+		from := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+		to := from.AddDate(0, 0, 7)
+
+		event := models.Event{
+			Name:       "weekly",
+			Timestamp:  to.AddDate(0, 0, 7),
+			Recurrence: &models.Recurrence{RRule: "FREQ=WEEKLY;COUNT=3"},
+		}
+		event.ID = createEvent(t.Context(), t, repo, event)
+		createEvent(t.Context(), t, repo, models.Event{Name: "later", Timestamp: to.AddDate(0, 0, 1)})
+
+		override := models.OccurrenceOverride{
+			EventID:      event.ID,
+			RecurrenceID: event.Timestamp,
+			Name:         "moved",
+			Timestamp:    from.Add(time.Hour),
+		}
+
+		_, err := repo.UpdateOccurrence(t.Context(), override, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		events, overrides, err := repo.GetOccurrenceEvents(t.Context(), models.OccurrenceFilter{From: from, To: to})
+		if err != nil {
+			t.Fatal(err)
+		} else if ids := eventIDs(events); !slices.Equal(ids, []uint64{event.ID}) || len(overrides) != 1 {
+			t.Fatalf("got events %v with %d overrides, want event %d with the moved occurrence", ids, len(overrides), event.ID)
+		}
+	})
+}
+
+func TestEventCheck(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *sqlxutils.DB) {
+		repo := newRepository(db)
+		insertUsers(t.Context(), t, db, 3)
+
+		id := createEvent(t.Context(), t, repo, models.Event{Name: "event", Timestamp: time.Now(), UserIDs: []uint64{1, 2}})
+		errDenied := errors.New("denied")
+
+		var checked models.Event
+
+		check := func(event models.Event, removedUserIDs []uint64) error {
+			checked = event
+			if slices.Contains(removedUserIDs, 2) {
+				return errDenied
+			}
+
+			return nil
+		}
+
+		mask := models.FieldMask{models.EventFieldUserIDs}
+
+		_, err := repo.UpdateEvent(t.Context(), models.Event{ID: id, UserIDs: []uint64{1}}, mask, check)
+		if !errors.Is(err, errDenied) {
+			t.Fatalf("got error %v for removing a participant by an update, want the error of the check", err)
+		}
+
+		_, err = repo.RemoveEventUsers(t.Context(), id, []uint64{2}, check)
+		if !errors.Is(err, errDenied) {
+			t.Fatalf("got error %v for removing a participant, want the error of the check", err)
+		}
+
+		event, err := repo.AddEventUsers(t.Context(), id, []uint64{3}, check)
+		if err != nil {
+			t.Fatal(err)
+		} else if want := []uint64{1, 2}; checked.ID != id || !slices.Equal(checked.UserIDs, want) {
+			t.Fatalf("checked event %d with participants %v, want event %d with %v", checked.ID, checked.UserIDs, id, want)
+		} else if want = []uint64{1, 2, 3}; !slices.Equal(event.UserIDs, want) {
+			t.Fatalf("got participants %v, want %v", event.UserIDs, want)
+		}
+	})
+}
+
+func BenchmarkGetEvents(b *testing.B) {
+	dbtest.Benchmark(b, func(b *testing.B, db *sqlxutils.DB) {
+		repo := newRepository(db)
+		insertUsers(b.Context(), b, db, benchmarkUsers)
+		insertEvents(b.Context(), b, db, benchmarkEvents, benchmarkParticipants, benchmarkUsers)
+
+		for b.Loop() {
+			page := models.Page{Limit: benchmarkPageLimit}
+
+			for {
+				events, _, err := repo.GetEvents(b.Context(), models.EventFilter{}, page)
+				if err != nil {
+					b.Fatal(err)
+				} else if uint64(len(events)) < page.Limit {
+					break
+				}
+
+				last := events[len(events)-1]
+				page.After = models.Cursor{ID: last.ID, Timestamp: last.Timestamp}
+			}
+		}
+	})
+}
@@ -2,58 +2,523 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/Inspirate789/grpc-template/internal/models"
+	"github.com/Inspirate789/grpc-template/internal/pkg/auth"
+	"github.com/Inspirate789/grpc-template/internal/pkg/tracing"
+	"github.com/Inspirate789/grpc-template/pkg/changebus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Repository interface {
 	HealthCheck(ctx context.Context) error
-	CreateEvent(ctx context.Context, name string, timestamp time.Time, userIDs []uint64) (id uint64, err error)
-	UpdateEvent(ctx context.Context, event models.Event) (found bool, err error)
-	DeleteEvent(ctx context.Context, id uint64) error
-	GetEvent(ctx context.Context, id uint64) (event models.Event, found bool, err error)
-	GetEvents(ctx context.Context, limit, offset uint64) ([]models.Event, uint64, error)
-	GetEventsByUser(ctx context.Context, userID, limit, offset uint64) ([]models.Event, uint64, error)
+	CreateEvent(ctx context.Context, event models.Event) (id uint64, created bool, err error)
+	UpdateEvent(ctx context.Context, event models.Event, mask models.FieldMask, check models.EventCheck) (models.Event, error)
+	AddEventUsers(ctx context.Context, eventID uint64, userIDs []uint64, check models.EventCheck) (models.Event, error)
+	RemoveEventUsers(ctx context.Context, eventID uint64, userIDs []uint64, check models.EventCheck) (models.Event, error)
+	DeleteEvent(ctx context.Context, id, version uint64, check models.EventCheck) (models.Event, error)
+	GetEvent(ctx context.Context, id uint64, showDeleted bool) (models.Event, error)
+	GetEvents(ctx context.Context, filter models.EventFilter, page models.Page) ([]models.Event, uint64, error)
+	GetEventsByIDs(ctx context.Context, ids []uint64, showDeleted bool) ([]models.Event, error)
+	DeleteEvents(ctx context.Context, ids []uint64, mode models.BatchMode) ([]models.Event, []models.BatchResult, error)
+	RestoreEvent(ctx context.Context, id uint64, check models.EventCheck) (models.Event, error)
+	PurgeEvents(ctx context.Context, before time.Time) (int64, error)
+	GetOccurrenceEvents(ctx context.Context, filter models.OccurrenceFilter) ([]models.Event, []models.OccurrenceOverride, error)
+	UpdateOccurrence(ctx context.Context, override models.OccurrenceOverride, check models.EventCheck) (models.Event, error)
+	CancelOccurrence(ctx context.Context, eventID uint64, recurrenceID time.Time, check models.EventCheck) (models.Event, error)
+	GetCalendarEvents(ctx context.Context, events []models.Event) ([]models.CalendarEvent, error)
+	ImportEvents(ctx context.Context, events []models.CalendarEvent, matchAttendees bool) (models.CalendarImport, error)
 }
 
+const tracerName = "github.com/Inspirate789/grpc-template/internal/event/usecase"
+
+const (
+	changesHistorySize = 1024
+	changesBufferSize  = 64
+)
+
+// maxExportedEvents limits the events of a calendar rendered in one response.
+const maxExportedEvents = 10000
+
 type UseCase struct {
 	repository Repository
+	changes    *changebus.Bus[models.EventChange]
+	tracer     trace.Tracer
 	logger     *slog.Logger
 }
 
 func New(repository Repository, logger *slog.Logger) *UseCase {
 	return &UseCase{
 		repository: repository,
+		changes:    changebus.New[models.EventChange](changesHistorySize, changesBufferSize),
+		tracer:     otel.Tracer(tracerName),
 		logger:     logger,
 	}
 }
 
+// HealthCheck is not traced: it runs periodically in the background and is filtered out of gRPC tracing.
 func (u *UseCase) HealthCheck(ctx context.Context) error {
 	return u.repository.HealthCheck(ctx)
 }
 
-func (u *UseCase) CreateEvent(ctx context.Context, name string, timestamp time.Time, userIDs []uint64) (id uint64, err error) {
-	return u.repository.CreateEvent(ctx, name, timestamp, userIDs)
+func (u *UseCase) publish(changeType models.ChangeType, event models.Event) {
+	u.changes.Publish(models.EventChange{
+		Type:  changeType,
+		Event: event,
+	})
+}
+
+func (u *UseCase) CreateEvent(ctx context.Context, event models.Event) (id uint64, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.CreateEvent")
+	defer func() { tracing.End(span, err) }()
+
+	if event.Recurrence != nil {
+		err = event.Recurrence.Validate(event.Timestamp)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	id, created, err := u.repository.CreateEvent(ctx, event)
+	if err != nil {
+		return 0, err
+	}
+
+	// A retried request doesn't create the event again, so it was published by the first one.
+	if created {
+		event.ID = id
+		event.Version = 1
+		u.publish(models.ChangeCreated, event)
+	}
+
+	return id, nil
+}
+
+// ownerCheck enforces the owner rule of the authorization policy: if the call is allowed to owners only,
+// the principal must participate in the event and may remove no participants but themselves.
+// The repository runs it in the transaction changing the event, so a concurrent change of the participants
+// can't bypass it.
+func ownerCheck(ctx context.Context) models.EventCheck {
+	if !auth.OwnerOnly(ctx) {
+		return nil
+	}
+
+	principal, _ := auth.PrincipalFromContext(ctx)
+
+	return func(event models.Event, removedUserIDs []uint64) error {
+		denied := &models.PermissionDeniedError{
+			Resource:    models.EventResource,
+			Name:        strconv.FormatUint(event.ID, 10),
+			Description: "only participants may change the event",
+		}
+
+		if principal.UserID == 0 || !slices.Contains(event.UserIDs, principal.UserID) {
+			return denied
+		}
+
+		for _, userID := range removedUserIDs {
+			if userID != principal.UserID {
+				denied.Description = "participants may not remove other participants"
+				return denied
+			}
+		}
+
+		return nil
+	}
+}
+
+// UpdateEvent updates the fields of the event selected by mask; an empty mask updates all of them.
+// If event.Version is set, the event is updated only if its version matches.
+func (u *UseCase) UpdateEvent(ctx context.Context, event models.Event, mask models.FieldMask) (_ models.Event, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.UpdateEvent")
+	defer func() { tracing.End(span, err) }()
+
+	if mask.Has(models.EventFieldRecurrence) && event.Recurrence != nil {
+		err = event.Recurrence.Validate(event.Timestamp)
+		if err != nil {
+			return models.Event{}, err
+		}
+	}
+
+	updated, err := u.repository.UpdateEvent(ctx, event, mask, ownerCheck(ctx))
+	if err != nil {
+		return models.Event{}, err
+	}
+
+	u.publish(models.ChangeUpdated, updated)
+
+	return updated, nil
+}
+
+func (u *UseCase) AddEventUsers(ctx context.Context, eventID uint64, userIDs []uint64) (_ models.Event, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.AddEventUsers")
+	defer func() { tracing.End(span, err) }()
+
+	event, err := u.repository.AddEventUsers(ctx, eventID, userIDs, ownerCheck(ctx))
+	if err != nil {
+		return models.Event{}, err
+	}
+
+	u.publish(models.ChangeUpdated, event)
+
+	return event, nil
+}
+
+func (u *UseCase) RemoveEventUsers(ctx context.Context, eventID uint64, userIDs []uint64) (_ models.Event, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.RemoveEventUsers")
+	defer func() { tracing.End(span, err) }()
+
+	event, err := u.repository.RemoveEventUsers(ctx, eventID, userIDs, ownerCheck(ctx))
+	if err != nil {
+		return models.Event{}, err
+	}
+
+	u.publish(models.ChangeUpdated, event)
+
+	return event, nil
+}
+
+// DeleteEvent soft-deletes the event if its version matches, unless version is zero.
+func (u *UseCase) DeleteEvent(ctx context.Context, id, version uint64) (err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.DeleteEvent")
+	defer func() { tracing.End(span, err) }()
+
+	event, err := u.repository.DeleteEvent(ctx, id, version, ownerCheck(ctx))
+	if err != nil {
+		return err
+	}
+
+	u.publish(models.ChangeDeleted, event)
+
+	return nil
+}
+
+func (u *UseCase) RestoreEvent(ctx context.Context, id uint64) (_ models.Event, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.RestoreEvent")
+	defer func() { tracing.End(span, err) }()
+
+	event, err := u.repository.RestoreEvent(ctx, id, ownerCheck(ctx))
+	if err != nil {
+		return models.Event{}, err
+	}
+
+	u.publish(models.ChangeRestored, event)
+
+	return event, nil
+}
+
+// PurgeDeleted hard-deletes events soft-deleted before the given time and returns their number.
+func (u *UseCase) PurgeDeleted(ctx context.Context, before time.Time) (_ int64, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.PurgeDeleted")
+	defer func() { tracing.End(span, err) }()
+
+	return u.repository.PurgeEvents(ctx, before)
+}
+
+// ListOccurrences expands events matching the filter into their occurrences ordered by start time,
+// returning at most limit of them.
+func (u *UseCase) ListOccurrences(
+	ctx context.Context,
+	filter models.OccurrenceFilter,
+	limit uint64,
+) (_ []models.Occurrence, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.ListOccurrences")
+	defer func() { tracing.End(span, err) }()
+
+	events, overrides, err := u.repository.GetOccurrenceEvents(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	overridesByEvent := make(map[uint64][]models.OccurrenceOverride)
+	for _, override := range overrides {
+		overridesByEvent[override.EventID] = append(overridesByEvent[override.EventID], override)
+	}
+
+	res := make([]models.Occurrence, 0)
+
+	for _, event := range events {
+		occurrences, err := event.Occurrences(filter.From, filter.To, overridesByEvent[event.ID], limit)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, occurrences...)
+	}
+
+	models.SortOccurrences(res)
+
+	if uint64(len(res)) > limit {
+		res = res[:limit]
+	}
+
+	return res, nil
+}
+
+// UpdateOccurrence changes a single occurrence of a recurring event without changing the series.
+func (u *UseCase) UpdateOccurrence(ctx context.Context, override models.OccurrenceOverride) (_ models.Occurrence, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.UpdateOccurrence")
+	defer func() { tracing.End(span, err) }()
+
+	event, err := u.repository.UpdateOccurrence(ctx, override, ownerCheck(ctx))
+	if err != nil {
+		return models.Occurrence{}, err
+	}
+
+	u.publish(models.ChangeUpdated, event)
+
+	return event.Override(override), nil
 }
 
-func (u *UseCase) UpdateEvent(ctx context.Context, event models.Event) (found bool, err error) {
-	return u.repository.UpdateEvent(ctx, event)
+// CancelOccurrence excludes a single occurrence from a recurring event without changing the rest of the series.
+func (u *UseCase) CancelOccurrence(ctx context.Context, eventID uint64, recurrenceID time.Time) (_ models.Event, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.CancelOccurrence")
+	defer func() { tracing.End(span, err) }()
+
+	event, err := u.repository.CancelOccurrence(ctx, eventID, recurrenceID, ownerCheck(ctx))
+	if err != nil {
+		return models.Event{}, err
+	}
+
+	u.publish(models.ChangeUpdated, event)
+
+	return event, nil
 }
 
-func (u *UseCase) DeleteEvent(ctx context.Context, id uint64) error {
-	return u.repository.DeleteEvent(ctx, id)
+// ExportEvents returns the events matching the filter along with the names of their participants
+// and the overrides of their occurrences. The events are read page by page and there may be at most
+// maxExportedEvents of them.
+func (u *UseCase) ExportEvents(ctx context.Context, filter models.EventFilter) (_ []models.CalendarEvent, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.ExportEvents")
+	defer func() { tracing.End(span, err) }()
+
+	res := make([]models.CalendarEvent, 0)
+	page := models.Page{Limit: models.DefaultPageLimit}
+
+	for {
+		var (
+			events         []models.Event
+			calendarEvents []models.CalendarEvent
+		)
+
+		events, _, err = u.repository.GetEvents(ctx, filter, page)
+		if err != nil {
+			return nil, err
+		}
+
+		calendarEvents, err = u.repository.GetCalendarEvents(ctx, events)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, calendarEvents...)
+		if len(res) > maxExportedEvents {
+			return nil, &models.ResourceExhaustedError{
+				Description: "more than " + strconv.Itoa(maxExportedEvents) + " events to export",
+			}
+		}
+
+		if uint64(len(events)) < page.Limit {
+			return res, nil
+		}
+
+		last := events[len(events)-1]
+		page.After = models.Cursor{ID: last.ID, Timestamp: last.Timestamp, Name: last.Name}
+	}
 }
 
-func (u *UseCase) GetEvent(ctx context.Context, id uint64) (event models.Event, found bool, err error) {
-	return u.repository.GetEvent(ctx, id)
+// ExportEvent returns the event along with the names of its participants and the overrides of its occurrences.
+func (u *UseCase) ExportEvent(ctx context.Context, id uint64) (_ models.CalendarEvent, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.ExportEvent")
+	defer func() { tracing.End(span, err) }()
+
+	event, err := u.repository.GetEvent(ctx, id, false)
+	if err != nil {
+		return models.CalendarEvent{}, err
+	}
+
+	events, err := u.repository.GetCalendarEvents(ctx, []models.Event{event})
+	if err != nil {
+		return models.CalendarEvent{}, err
+	}
+
+	return events[0], nil
 }
 
-func (u *UseCase) GetEvents(ctx context.Context, limit, offset uint64) ([]models.Event, uint64, error) {
-	return u.repository.GetEvents(ctx, limit, offset)
+func validateCalendarEvent(event models.CalendarEvent) error {
+	if event.Event.Recurrence != nil {
+		err := event.Event.Recurrence.Validate(event.Event.Timestamp)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, override := range event.Overrides {
+		ok, err := event.Event.HasOccurrence(override.RecurrenceID)
+		if err != nil {
+			return err
+		} else if !ok {
+			return models.NewInvalidArgumentError(models.FieldViolation{
+				Field:       "calendar",
+				Description: "RECURRENCE-ID of " + strconv.Quote(event.Event.Name) + " does not match an occurrence",
+			})
+		}
+	}
+
+	return nil
 }
 
-func (u *UseCase) GetEventsByUser(ctx context.Context, userID, limit, offset uint64) ([]models.Event, uint64, error) {
-	return u.repository.GetEventsByUser(ctx, userID, limit, offset)
+// ImportEvents creates events with their changed occurrences; it either creates all of them or none.
+// If matchAttendees is set, the users named by the attendees become participants as well.
+func (u *UseCase) ImportEvents(
+	ctx context.Context,
+	events []models.CalendarEvent,
+	matchAttendees bool,
+) (_ models.CalendarImport, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.ImportEvents")
+	defer func() { tracing.End(span, err) }()
+
+	for _, event := range events {
+		err = validateCalendarEvent(event)
+		if err != nil {
+			return models.CalendarImport{}, err
+		}
+	}
+
+	res, err := u.repository.ImportEvents(ctx, events, matchAttendees)
+	if err != nil {
+		return models.CalendarImport{}, err
+	}
+
+	for _, event := range res.Events {
+		u.publish(models.ChangeCreated, event)
+	}
+
+	return res, nil
+}
+
+func (u *UseCase) GetEvent(ctx context.Context, id uint64, showDeleted bool) (_ models.Event, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.GetEvent")
+	defer func() { tracing.End(span, err) }()
+
+	return u.repository.GetEvent(ctx, id, showDeleted)
+}
+
+func (u *UseCase) GetEvents(
+	ctx context.Context,
+	filter models.EventFilter,
+	page models.Page,
+) (_ []models.Event, _ uint64, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.GetEvents")
+	defer func() { tracing.End(span, err) }()
+
+	return u.repository.GetEvents(ctx, filter, page)
+}
+
+// BatchGetEvents returns events in the order of ids along with the ids that don't exist.
+func (u *UseCase) BatchGetEvents(
+	ctx context.Context,
+	ids []uint64,
+	showDeleted bool,
+) (events []models.Event, missing []uint64, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.BatchGetEvents")
+	defer func() { tracing.End(span, err) }()
+
+	events, err = u.repository.GetEventsByIDs(ctx, ids, showDeleted)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	events, missing = models.OrderByIDs(ids, events, func(event models.Event) uint64 { return event.ID })
+
+	return events, missing, nil
+}
+
+func (u *UseCase) BatchDeleteEvents(ctx context.Context, ids []uint64, mode models.BatchMode) (_ []models.BatchResult, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.BatchDeleteEvents")
+	defer func() { tracing.End(span, err) }()
+
+	if auth.OwnerOnly(ctx) {
+		return nil, &models.PermissionDeniedError{Description: "batch deletion is not available to event owners"}
+	}
+
+	events, results, err := u.repository.DeleteEvents(ctx, ids, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, event := range events {
+		u.publish(models.ChangeDeleted, event)
+	}
+
+	return results, nil
+}
+
+func watchErr(err error) error {
+	switch {
+	case errors.Is(err, changebus.ErrRevisionTooOld), errors.Is(err, changebus.ErrRevisionTooNew),
+		errors.Is(err, changebus.ErrRevisionUnknown):
+		return &models.FailedPreconditionError{
+			Subject:     "from_revision",
+			Description: err.Error() + "; reload events and watch without a revision",
+		}
+	case errors.Is(err, changebus.ErrSlowConsumer):
+		return &models.ResourceExhaustedError{Description: err.Error() + "; resume from the last received revision"}
+	default:
+		return err
+	}
+}
+
+// WatchEvents streams changes matching the filter to send until the context is done.
+// If fromRevision is set, retained changes after it are replayed first.
+// Its span lasts as long as the stream.
+func (u *UseCase) WatchEvents(
+	ctx context.Context,
+	filter models.EventChangeFilter,
+	fromRevision *uint64,
+	send func(change models.EventChange) error,
+) (err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.WatchEvents")
+	defer func() { tracing.End(span, err) }()
+
+	sub, backlog, err := u.changes.Subscribe(fromRevision)
+	if err != nil {
+		return watchErr(err)
+	}
+	defer sub.Close()
+
+	for _, change := range backlog {
+		change.Value.Revision = change.Revision
+		if filter.Match(change.Value.Event) {
+			err = send(change.Value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case change, ok := <-sub.C:
+			if !ok {
+				return watchErr(sub.Err())
+			}
+
+			change.Value.Revision = change.Revision
+			if filter.Match(change.Value.Event) {
+				err = send(change.Value)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
 }
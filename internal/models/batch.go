@@ -0,0 +1,38 @@
+package models
+
+type BatchMode int
+
+const (
+	// BatchAtomic applies all items in one transaction or fails without changes.
+	BatchAtomic BatchMode = iota
+	// BatchBestEffort applies items independently and reports failures per item.
+	BatchBestEffort
+)
+
+type BatchResult struct {
+	ID  uint64
+	Err error
+}
+
+// OrderByIDs arranges items in the order of ids and reports the ids without a matching item.
+func OrderByIDs[T any](ids []uint64, items []T, id func(T) uint64) (ordered []T, missing []uint64) {
+	byID := make(map[uint64]T, len(items))
+	for _, item := range items {
+		byID[id(item)] = item
+	}
+
+	ordered = make([]T, 0, len(items))
+	missing = make([]uint64, 0)
+
+	for _, itemID := range ids {
+		item, ok := byID[itemID]
+		if !ok {
+			missing = append(missing, itemID)
+			continue
+		}
+
+		ordered = append(ordered, item)
+	}
+
+	return ordered, missing
+}
@@ -0,0 +1,17 @@
+package models
+
+// CalendarEvent is an event exchanged as iCalendar along with its changed occurrences.
+type CalendarEvent struct {
+	Event Event
+	// Attendees are the names of the participants; exported events list them in the order of Event.UserIDs.
+	Attendees []string
+	Overrides []OccurrenceOverride
+}
+
+// CalendarImport is the result of importing events from iCalendar.
+type CalendarImport struct {
+	// Events are the created events.
+	Events []Event
+	// UnmatchedAttendees are the attendee names that don't belong to exactly one user.
+	UnmatchedAttendees []string
+}
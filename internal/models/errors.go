@@ -0,0 +1,123 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+type NotFoundError struct {
+	Resource string
+	Name     string
+}
+
+func NewNotFoundError(resource string, id uint64) *NotFoundError {
+	return &NotFoundError{
+		Resource: resource,
+		Name:     strconv.FormatUint(id, 10),
+	}
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Resource + " " + e.Name + " not found"
+}
+
+type AlreadyExistsError struct {
+	Resource string
+	Name     string
+}
+
+func (e *AlreadyExistsError) Error() string {
+	return e.Resource + " " + e.Name + " already exists"
+}
+
+type InvalidArgumentError struct {
+	Violations []FieldViolation
+}
+
+func NewInvalidArgumentError(violations ...FieldViolation) *InvalidArgumentError {
+	return &InvalidArgumentError{Violations: violations}
+}
+
+func (e *InvalidArgumentError) Error() string {
+	msgs := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		// Violations of message-level rules are not bound to a field.
+		if violation.Field == "" {
+			msgs = append(msgs, violation.Description)
+			continue
+		}
+
+		msgs = append(msgs, violation.Field+": "+violation.Description)
+	}
+
+	return "invalid argument: " + strings.Join(msgs, "; ")
+}
+
+type FailedPreconditionError struct {
+	Subject     string
+	Description string
+}
+
+func (e *FailedPreconditionError) Error() string {
+	return "failed precondition: " + e.Subject + ": " + e.Description
+}
+
+type ConflictError struct {
+	Resource    string
+	Name        string
+	Description string
+}
+
+func (e *ConflictError) Error() string {
+	return e.Resource + " " + e.Name + " conflict: " + e.Description
+}
+
+// VersionMismatchError reports a conditional change of a resource whose version
+// differs from the one the client expected.
+type VersionMismatchError struct {
+	Resource string
+	Name     string
+	Expected uint64
+	Actual   uint64
+}
+
+func NewVersionMismatchError(resource string, id, expected, actual uint64) *VersionMismatchError {
+	return &VersionMismatchError{
+		Resource: resource,
+		Name:     strconv.FormatUint(id, 10),
+		Expected: expected,
+		Actual:   actual,
+	}
+}
+
+func (e *VersionMismatchError) Error() string {
+	return e.Resource + " " + e.Name + " version mismatch: expected " + strconv.FormatUint(e.Expected, 10) +
+		", actual " + strconv.FormatUint(e.Actual, 10)
+}
+
+type ResourceExhaustedError struct {
+	Description string
+}
+
+func (e *ResourceExhaustedError) Error() string {
+	return "resource exhausted: " + e.Description
+}
+
+type PermissionDeniedError struct {
+	Resource    string
+	Name        string
+	Description string
+}
+
+func (e *PermissionDeniedError) Error() string {
+	if e.Resource == "" {
+		return "permission denied: " + e.Description
+	}
+
+	return "permission denied on " + e.Resource + " " + e.Name + ": " + e.Description
+}
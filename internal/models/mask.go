@@ -0,0 +1,39 @@
+package models
+
+import "slices"
+
+// Fields of an event that an update can be limited to.
+const (
+	EventFieldName       = "name"
+	EventFieldTimestamp  = "timestamp"
+	EventFieldUserIDs    = "user_ids"
+	EventFieldRecurrence = "recurrence"
+)
+
+// FieldMask lists the fields an update applies to; an empty mask applies to all of them.
+type FieldMask []string
+
+func (m FieldMask) Has(field string) bool {
+	return len(m) == 0 || slices.Contains(m, field)
+}
+
+// Merge returns the event with the fields selected by mask taken from update.
+func (e Event) Merge(update Event, mask FieldMask) Event {
+	if mask.Has(EventFieldName) {
+		e.Name = update.Name
+	}
+
+	if mask.Has(EventFieldTimestamp) {
+		e.Timestamp = update.Timestamp
+	}
+
+	if mask.Has(EventFieldUserIDs) {
+		e.UserIDs = update.UserIDs
+	}
+
+	if mask.Has(EventFieldRecurrence) {
+		e.Recurrence = update.Recurrence
+	}
+
+	return e
+}
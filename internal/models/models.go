@@ -1,10 +1,23 @@
 package models
 
-import "time"
+import (
+	"slices"
+	"time"
+)
+
+const (
+	UserResource  = "user"
+	EventResource = "event"
+)
 
 type User struct {
 	ID   uint64
 	Name string
+	// DeletedAt is set for soft-deleted users until they are restored or purged.
+	DeletedAt *time.Time
+	// Version is incremented on every change. In an update it is the expected version,
+	// zero meaning any.
+	Version uint64
 }
 
 type Event struct {
@@ -12,4 +25,91 @@ type Event struct {
 	Name      string
 	Timestamp time.Time
 	UserIDs   []uint64
+	// DeletedAt is set for soft-deleted events until they are restored or purged.
+	DeletedAt *time.Time
+	// Version is incremented on every change, including changes of participants.
+	// In an update it is the expected version, zero meaning any.
+	Version uint64
+	// Recurrence is set for recurring events.
+	Recurrence *Recurrence
+}
+
+// EventCheck is called by the repository with the current event in the transaction changing it,
+// along with the participants the change removes, so the check can't race with other changes.
+type EventCheck func(event Event, removedUserIDs []uint64) error
+
+type ChangeType int
+
+const (
+	ChangeCreated ChangeType = iota + 1
+	ChangeUpdated
+	ChangeDeleted
+	ChangeRestored
+)
+
+type EventChange struct {
+	Revision uint64
+	Type     ChangeType
+	Event    Event
+}
+
+type EventOrder int
+
+const (
+	EventOrderTimestamp EventOrder = iota
+	EventOrderTimestampDesc
+	EventOrderName
+	EventOrderID
+)
+
+func (o EventOrder) String() string {
+	switch o {
+	case EventOrderTimestampDesc:
+		return "timestamp_desc"
+	case EventOrderName:
+		return "name"
+	case EventOrderID:
+		return "id"
+	default:
+		return "timestamp"
+	}
+}
+
+type UserMatch int
+
+const (
+	// UserMatchAny selects events with any of the users.
+	UserMatchAny UserMatch = iota
+	// UserMatchAll selects events with all of the users.
+	UserMatchAll
+)
+
+// EventFilter selects the events listed by GetEvents; zero values don't filter.
+type EventFilter struct {
+	From *time.Time
+	To   *time.Time
+	// NamePrefix and NameContains are matched case-insensitively.
+	NamePrefix   string
+	NameContains string
+	UserIDs      []uint64
+	UserMatch    UserMatch
+	Order        EventOrder
+}
+
+type EventChangeFilter struct {
+	UserID *uint64
+	From   *time.Time
+	To     *time.Time
+}
+
+func (f EventChangeFilter) Match(event Event) bool {
+	if f.UserID != nil && !slices.Contains(event.UserIDs, *f.UserID) {
+		return false
+	}
+
+	if f.From != nil && event.Timestamp.Before(*f.From) {
+		return false
+	}
+
+	return f.To == nil || !event.Timestamp.After(*f.To)
 }
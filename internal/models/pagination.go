@@ -0,0 +1,124 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+// DefaultPageLimit is the page size of lists requested without a limit; further pages are listed
+// with the returned page token.
+const DefaultPageLimit = 100
+
+// filterHashSize is the number of bytes of the filter digest kept in page tokens.
+const filterHashSize = 12
+
+// PageQuery identifies a listing: a page token continues only the listing it was returned for.
+type PageQuery struct {
+	Order string `json:"order,omitempty"`
+	// Filter is a digest of the filters of the listing.
+	Filter string `json:"filter,omitempty"`
+}
+
+// NewPageQuery returns the query of a listing in the given order with the given filters.
+func NewPageQuery(order string, filters ...any) PageQuery {
+	data, err := json.Marshal(filters)
+	if err != nil {
+		return PageQuery{Order: order}
+	}
+
+	hash := sha256.Sum256(data)
+
+	return PageQuery{Order: order, Filter: base64.RawURLEncoding.EncodeToString(hash[:filterHashSize])}
+}
+
+// Cursor points at the last row of a page; the next page starts right after it.
+type Cursor struct {
+	ID        uint64    `json:"id"`
+	Timestamp time.Time `json:"ts,omitzero"`
+	Name      string    `json:"name,omitempty"`
+	PageQuery
+}
+
+type Page struct {
+	Limit          uint64
+	Offset         uint64
+	After          Cursor
+	WithTotalCount bool
+	// ShowDeleted includes soft-deleted rows.
+	ShowDeleted bool
+}
+
+// NewPage returns the page of the listing identified by query. A page token is rejected if it was
+// returned for another order or other filters, and so is an offset along with a page token.
+func NewPage(limit, offset uint64, pageToken string, withTotalCount bool, query PageQuery) (Page, error) {
+	page := Page{
+		Limit:          limit,
+		Offset:         offset,
+		WithTotalCount: withTotalCount,
+	}
+
+	if pageToken == "" {
+		return page, nil
+	}
+
+	if offset != 0 {
+		return Page{}, NewInvalidArgumentError(FieldViolation{
+			Field:       "offset",
+			Description: "offset must not be set along with page_token",
+		})
+	}
+
+	after, err := ParseCursor(pageToken)
+	if err != nil {
+		return Page{}, err
+	}
+
+	switch {
+	case after.Order != query.Order:
+		return Page{}, NewInvalidArgumentError(FieldViolation{
+			Field:       "page_token",
+			Description: "page token was returned for another order",
+		})
+	case after.Filter != query.Filter:
+		return Page{}, NewInvalidArgumentError(FieldViolation{
+			Field:       "page_token",
+			Description: "page token was returned for other filters",
+		})
+	}
+
+	page.After = after
+
+	return page, nil
+}
+
+func (c Cursor) Token() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func ParseCursor(token string) (Cursor, error) {
+	invalidToken := NewInvalidArgumentError(FieldViolation{
+		Field:       "page_token",
+		Description: "invalid page token",
+	})
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, invalidToken
+	}
+
+	var cursor Cursor
+
+	err = json.Unmarshal(data, &cursor)
+	if err != nil {
+		return Cursor{}, invalidToken
+	}
+
+	return cursor, nil
+}
@@ -0,0 +1,44 @@
+package models_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Inspirate789/grpc-template/internal/models"
+)
+
+func TestNewPage(t *testing.T) {
+	filter, otherFilter := models.EventFilter{NamePrefix: "a"}, models.EventFilter{NamePrefix: "b"}
+	order, otherOrder := models.EventOrderName.String(), models.EventOrderID.String()
+	query := models.NewPageQuery(order, filter, false)
+	token := models.Cursor{ID: 3, Name: "ab", PageQuery: query}.Token()
+
+	page, err := models.NewPage(10, 0, token, false, query)
+	if err != nil {
+		t.Fatal(err)
+	} else if page.After.ID != 3 || page.After.Name != "ab" {
+		t.Fatalf("got cursor %+v, want the one of the token", page.After)
+	}
+
+	tests := []struct {
+		name   string
+		offset uint64
+		token  string
+		query  models.PageQuery
+	}{
+		{name: "offset", offset: 1, token: token, query: query},
+		{name: "order", token: token, query: models.NewPageQuery(otherOrder, filter, false)},
+		{name: "filter", token: token, query: models.NewPageQuery(order, otherFilter, false)},
+		{name: "show deleted", token: token, query: models.NewPageQuery(order, filter, true)},
+		{name: "malformed", token: token[1:], query: query},
+	}
+
+	for _, test := range tests {
+		var invalidArgument *models.InvalidArgumentError
+
+		_, err = models.NewPage(10, test.offset, test.token, false, test.query)
+		if !errors.As(err, &invalidArgument) {
+			t.Errorf("%s: got error %v, want InvalidArgument", test.name, err)
+		}
+	}
+}
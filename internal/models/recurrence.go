@@ -0,0 +1,260 @@
+package models
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/teambition/rrule-go"
+)
+
+// maxOccurrenceIterations bounds the occurrences of a rule, including the ones before a window,
+// that are generated to expand an event.
+const maxOccurrenceIterations = 100000
+
+// Recurrence repeats an event; the event timestamp is the start of the first occurrence.
+type Recurrence struct {
+	// RRule is an iCalendar RRULE without DTSTART, e.g. "FREQ=WEEKLY;BYDAY=MO".
+	RRule string
+	// TimeZone is the IANA time zone the rule is expanded in, so occurrences keep their
+	// local time across DST changes; empty means UTC.
+	TimeZone string
+	// ExDates are the start times of cancelled occurrences.
+	ExDates []time.Time
+}
+
+// OccurrenceOverride changes a single occurrence of a recurring event without changing the series.
+type OccurrenceOverride struct {
+	EventID uint64
+	// RecurrenceID is the start time the occurrence has according to the rule.
+	RecurrenceID time.Time
+	Name         string
+	Timestamp    time.Time
+}
+
+type Occurrence struct {
+	EventID      uint64
+	RecurrenceID time.Time
+	Name         string
+	Timestamp    time.Time
+	UserIDs      []uint64
+	// Modified is set for occurrences changed by an override.
+	Modified bool
+}
+
+type OccurrenceFilter struct {
+	From    time.Time
+	To      time.Time
+	EventID *uint64
+	UserID  *uint64
+}
+
+func (r Recurrence) location() (*time.Location, error) {
+	if r.TimeZone == "" {
+		return time.UTC, nil
+	}
+
+	location, err := time.LoadLocation(r.TimeZone)
+	if err != nil {
+		return nil, NewInvalidArgumentError(FieldViolation{
+			Field:       "recurrence.time_zone",
+			Description: "unknown time zone",
+		})
+	}
+
+	return location, nil
+}
+
+// set builds the recurrence set of the event starting at start.
+func (r Recurrence) set(start time.Time) (*rrule.Set, error) {
+	location, err := r.location()
+	if err != nil {
+		return nil, err
+	}
+
+	option, err := rrule.StrToROptionInLocation(r.RRule, location)
+	if err != nil {
+		return nil, NewInvalidArgumentError(FieldViolation{
+			Field:       "recurrence.rrule",
+			Description: err.Error(),
+		})
+	} else if !option.Dtstart.IsZero() {
+		return nil, NewInvalidArgumentError(FieldViolation{
+			Field:       "recurrence.rrule",
+			Description: "DTSTART is taken from the event timestamp and must not be set",
+		})
+	}
+
+	option.Dtstart = start.In(location)
+
+	rule, err := rrule.NewRRule(*option)
+	if err != nil {
+		return nil, NewInvalidArgumentError(FieldViolation{
+			Field:       "recurrence.rrule",
+			Description: err.Error(),
+		})
+	}
+
+	set := &rrule.Set{}
+	set.RRule(rule)
+	set.SetExDates(r.ExDates)
+
+	return set, nil
+}
+
+// Validate reports rules and time zones that can't be expanded and rules repeating more often than daily.
+func (r Recurrence) Validate(start time.Time) error {
+	set, err := r.set(start)
+	if err != nil {
+		return err
+	}
+
+	if set.GetRRule().OrigOptions.Freq > rrule.DAILY {
+		return NewInvalidArgumentError(FieldViolation{
+			Field:       "recurrence.rrule",
+			Description: "FREQ must not be more frequent than DAILY",
+		})
+	}
+
+	return nil
+}
+
+// iterate calls yield with the occurrences of set in order until it returns false. It fails
+// after maxOccurrenceIterations occurrences, so rules stored before they were limited to
+// daily ones can't make an expansion unbounded.
+func (e Event) iterate(set *rrule.Set, yield func(recurrenceID time.Time) bool) error {
+	next := set.Iterator()
+
+	for range maxOccurrenceIterations {
+		recurrenceID, ok := next()
+		if !ok || !yield(recurrenceID) {
+			return nil
+		}
+	}
+
+	return &ResourceExhaustedError{
+		Description: "event " + strconv.FormatUint(e.ID, 10) + " has too many occurrences to expand",
+	}
+}
+
+// occurs reports whether set has an occurrence starting at recurrenceID.
+func (e Event) occurs(set *rrule.Set, recurrenceID time.Time) (bool, error) {
+	found := false
+
+	err := e.iterate(set, func(occurrence time.Time) bool {
+		found = occurrence.Equal(recurrenceID)
+		return occurrence.Before(recurrenceID)
+	})
+
+	return found, err
+}
+
+// HasOccurrence reports whether the event has a not cancelled occurrence starting at recurrenceID.
+func (e Event) HasOccurrence(recurrenceID time.Time) (bool, error) {
+	if e.Recurrence == nil {
+		return false, nil
+	}
+
+	set, err := e.Recurrence.set(e.Timestamp)
+	if err != nil {
+		return false, err
+	}
+
+	return e.occurs(set, recurrenceID)
+}
+
+func (e Event) occurrence(recurrenceID time.Time) Occurrence {
+	return Occurrence{
+		EventID:      e.ID,
+		RecurrenceID: recurrenceID,
+		Name:         e.Name,
+		Timestamp:    recurrenceID,
+		UserIDs:      e.UserIDs,
+		Modified:     false,
+	}
+}
+
+func (o Occurrence) apply(override OccurrenceOverride) Occurrence {
+	o.Name = override.Name
+	o.Timestamp = override.Timestamp
+	o.Modified = true
+
+	return o
+}
+
+// Override returns the occurrence changed by override.
+func (e Event) Override(override OccurrenceOverride) Occurrence {
+	return e.occurrence(override.RecurrenceID).apply(override)
+}
+
+func (o Occurrence) within(from, to time.Time) bool {
+	return !o.Timestamp.Before(from) && !o.Timestamp.After(to)
+}
+
+// Occurrences expands the event into its occurrences starting within [from, to] after applying
+// overrides, so an occurrence moved into the window is included and one moved out of it is not.
+// Only the first limit occurrences without an override are expanded; with the overridden ones they
+// include the first limit occurrences of the event. A non-recurring event has a single occurrence.
+func (e Event) Occurrences(from, to time.Time, overrides []OccurrenceOverride, limit uint64) ([]Occurrence, error) {
+	if e.Recurrence == nil {
+		occurrence := e.occurrence(e.Timestamp)
+		if !occurrence.within(from, to) {
+			return nil, nil
+		}
+
+		return []Occurrence{occurrence}, nil
+	}
+
+	set, err := e.Recurrence.set(e.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Occurrence, 0)
+
+	err = e.iterate(set, func(recurrenceID time.Time) bool {
+		if recurrenceID.After(to) || uint64(len(res)) >= limit {
+			return false
+		}
+
+		overridden := slices.ContainsFunc(overrides, func(override OccurrenceOverride) bool {
+			return override.RecurrenceID.Equal(recurrenceID)
+		})
+		if !recurrenceID.Before(from) && !overridden {
+			res = append(res, e.occurrence(recurrenceID.UTC()))
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, override := range overrides {
+		occurrence := e.Override(override)
+		if !occurrence.within(from, to) {
+			continue
+		}
+
+		ok, occursErr := e.occurs(set, override.RecurrenceID)
+		if occursErr != nil {
+			return nil, occursErr
+		} else if ok {
+			res = append(res, occurrence)
+		}
+	}
+
+	return res, nil
+}
+
+// SortOccurrences orders occurrences by their start time and event id.
+func SortOccurrences(occurrences []Occurrence) {
+	slices.SortFunc(occurrences, func(a, b Occurrence) int {
+		if c := a.Timestamp.Compare(b.Timestamp); c != 0 {
+			return c
+		}
+
+		return cmp.Compare(a.EventID, b.EventID)
+	})
+}
@@ -0,0 +1,186 @@
+package models_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Inspirate789/grpc-template/internal/models"
+)
+
+func recurringEvent(start time.Time, recurrence models.Recurrence) models.Event {
+	return models.Event{ID: 1, Name: "event", Timestamp: start, Recurrence: &recurrence}
+}
+
+func timestamps(occurrences []models.Occurrence) []time.Time {
+	res := make([]time.Time, 0, len(occurrences))
+	for _, occurrence := range occurrences {
+		res = append(res, occurrence.Timestamp)
+	}
+
+	return res
+}
+
+func equalTimes(a, b []time.Time) bool {
+	return slices.EqualFunc(a, b, time.Time.Equal)
+}
+
+func TestRecurrenceValidate(t *testing.T) {
+	start := time.Date(2025, time.January, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		recurrence models.Recurrence
+		valid      bool
+	}{
+		{recurrence: models.Recurrence{RRule: "FREQ=WEEKLY;BYDAY=MO;COUNT=10"}, valid: true},
+		{recurrence: models.Recurrence{RRule: "FREQ=DAILY", TimeZone: "Europe/Berlin"}, valid: true},
+		{recurrence: models.Recurrence{RRule: "FREQ=HOURLY"}, valid: false},
+		{recurrence: models.Recurrence{RRule: "FREQ=MINUTELY;COUNT=10"}, valid: false},
+		{recurrence: models.Recurrence{RRule: "DTSTART:20250101T100000Z\nRRULE:FREQ=DAILY"}, valid: false},
+		{recurrence: models.Recurrence{RRule: "FREQ=SOMETIMES"}, valid: false},
+		{recurrence: models.Recurrence{RRule: "FREQ=DAILY", TimeZone: "Mars/Olympus_Mons"}, valid: false},
+	}
+
+	for _, test := range tests {
+		var invalidArgument *models.InvalidArgumentError
+
+		err := test.recurrence.Validate(start)
+		if test.valid && err != nil {
+			t.Errorf("got error %v for %+v, want it valid", err, test.recurrence)
+		} else if !test.valid && !errors.As(err, &invalidArgument) {
+			t.Errorf("got error %v for %+v, want InvalidArgument", err, test.recurrence)
+		}
+	}
+}
+
+func TestOccurrencesSingleEvent(t *testing.T) {
+	start := time.Date(2025, time.January, 1, 10, 0, 0, 0, time.UTC)
+	event := models.Event{ID: 1, Name: "event", Timestamp: start}
+
+	occurrences, err := event.Occurrences(start.Add(-time.Hour), start, nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	} else if !equalTimes(timestamps(occurrences), []time.Time{start}) {
+		t.Fatalf("got occurrences %v, want the event itself", timestamps(occurrences))
+	}
+
+	occurrences, err = event.Occurrences(start.Add(time.Second), start.Add(time.Hour), nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(occurrences) != 0 {
+		t.Fatalf("got occurrences %v of an event before the window", timestamps(occurrences))
+	}
+}
+
+func TestOccurrencesKeepLocalTimeAcrossDST(t *testing.T) {
+	// Clocks in Berlin move from UTC+1 to UTC+2 on 2025-03-30.
+	start := time.Date(2025, time.March, 24, 9, 0, 0, 0, time.UTC)
+	event := recurringEvent(start, models.Recurrence{RRule: "FREQ=WEEKLY;COUNT=3", TimeZone: "Europe/Berlin"})
+
+	occurrences, err := event.Occurrences(start, start.AddDate(0, 1, 0), nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []time.Time{start, start.AddDate(0, 0, 7).Add(-time.Hour), start.AddDate(0, 0, 14).Add(-time.Hour)}
+	if got := timestamps(occurrences); !equalTimes(got, want) {
+		t.Fatalf("got occurrences %v, want %v", got, want)
+	}
+}
+
+func TestOccurrencesExDates(t *testing.T) {
+	start := time.Date(2025, time.January, 1, 10, 0, 0, 0, time.UTC)
+	cancelled := start.AddDate(0, 0, 1)
+	event := recurringEvent(start, models.Recurrence{RRule: "FREQ=DAILY;COUNT=3", ExDates: []time.Time{cancelled}})
+
+	occurrences, err := event.Occurrences(start, start.AddDate(0, 0, 7), nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	} else if want := []time.Time{start, start.AddDate(0, 0, 2)}; !equalTimes(timestamps(occurrences), want) {
+		t.Fatalf("got occurrences %v, want %v", timestamps(occurrences), want)
+	}
+
+	ok, err := event.HasOccurrence(cancelled)
+	if err != nil {
+		t.Fatal(err)
+	} else if ok {
+		t.Fatalf("got a cancelled occurrence at %v", cancelled)
+	}
+}
+
+func TestOccurrencesOverrides(t *testing.T) {
+	start := time.Date(2025, time.January, 1, 10, 0, 0, 0, time.UTC)
+	event := recurringEvent(start, models.Recurrence{RRule: "FREQ=DAILY;COUNT=10"})
+	from, to := start.AddDate(0, 0, 2), start.AddDate(0, 0, 4)
+
+	overrides := []models.OccurrenceOverride{
+		// Moved within the window.
+		{EventID: 1, RecurrenceID: start.AddDate(0, 0, 2), Name: "later", Timestamp: start.AddDate(0, 0, 2).Add(time.Hour)},
+		// Moved out of the window.
+		{EventID: 1, RecurrenceID: start.AddDate(0, 0, 3), Name: "out", Timestamp: start.AddDate(0, 0, 8)},
+		// Moved into the window.
+		{EventID: 1, RecurrenceID: start.AddDate(0, 0, 9), Name: "in", Timestamp: start.AddDate(0, 0, 3).Add(time.Hour)},
+		// Not an occurrence of the rule.
+		{EventID: 1, RecurrenceID: start.AddDate(0, 0, 20), Name: "orphan", Timestamp: start.AddDate(0, 0, 3)},
+	}
+
+	occurrences, err := event.Occurrences(from, to, overrides, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	models.SortOccurrences(occurrences)
+
+	names := make([]string, 0, len(occurrences))
+	for _, occurrence := range occurrences {
+		names = append(names, occurrence.Name)
+	}
+
+	if want := []string{"later", "in", "event"}; !slices.Equal(names, want) {
+		t.Fatalf("got occurrences %v, want %v", names, want)
+	} else if !occurrences[0].Modified || occurrences[2].Modified {
+		t.Fatalf("got occurrences %+v, want only the overridden ones modified", occurrences)
+	}
+}
+
+func TestOccurrencesLimit(t *testing.T) {
+	start := time.Date(2025, time.January, 1, 10, 0, 0, 0, time.UTC)
+	event := recurringEvent(start, models.Recurrence{RRule: "FREQ=DAILY"})
+	moved := models.OccurrenceOverride{
+		EventID:      1,
+		RecurrenceID: start.AddDate(0, 0, 100),
+		Name:         "moved",
+		Timestamp:    start.Add(-time.Hour),
+	}
+
+	occurrences, err := event.Occurrences(start.AddDate(0, 0, -1), start.AddDate(1, 0, 0), []models.OccurrenceOverride{moved}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	models.SortOccurrences(occurrences)
+
+	if want := []time.Time{moved.Timestamp, start, start.AddDate(0, 0, 1)}; !equalTimes(timestamps(occurrences), want) {
+		t.Fatalf("got occurrences %v, want %v", timestamps(occurrences), want)
+	}
+}
+
+func TestOccurrencesIterationCap(t *testing.T) {
+	// Rules repeating more often than daily are rejected now, but may have been stored before.
+	start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	event := recurringEvent(start, models.Recurrence{RRule: "FREQ=MINUTELY"})
+	from := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	var resourceExhausted *models.ResourceExhaustedError
+
+	_, err := event.Occurrences(from, from.AddDate(0, 0, 1), nil, 10)
+	if !errors.As(err, &resourceExhausted) {
+		t.Fatalf("got error %v expanding a minutely rule from years ago, want ResourceExhausted", err)
+	}
+
+	_, err = event.HasOccurrence(from)
+	if !errors.As(err, &resourceExhausted) {
+		t.Fatalf("got error %v looking up an occurrence years after the start, want ResourceExhausted", err)
+	}
+}
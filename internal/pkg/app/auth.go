@@ -0,0 +1,173 @@
+package app
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Inspirate789/grpc-template/internal/models"
+	"github.com/Inspirate789/grpc-template/internal/pkg/auth"
+	"github.com/gofiber/fiber/v2"
+	middleware "github.com/grpc-ecosystem/go-grpc-middleware/v2"
+	grpcauth "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/auth"
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/metadata"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	authorizationHeader = "authorization"
+	apiKeyHeader        = "x-api-key"
+	bearerScheme        = "bearer"
+)
+
+type Authenticator interface {
+	Exempt(method string) bool
+	Authenticate(token string) (auth.Principal, error)
+}
+
+type Authorizer interface {
+	AuthorizeMethod(principal auth.Principal, fullMethod string) auth.Access
+	AuthorizeRoute(principal auth.Principal, httpMethod, routePath string) auth.Access
+}
+
+// ownerAwareAuthorizer denies the owner rule to the calls outside ownerAware, whose usecases don't check
+// that the principal owns the resource, so listing such a call in the owner section of the policy
+// can't grant it to every user.
+type ownerAwareAuthorizer struct {
+	authorizer Authorizer
+	ownerAware auth.Rules
+}
+
+// NewOwnerAwareAuthorizer lets authorizer grant the owner rule only to the methods and routes of ownerAware.
+func NewOwnerAwareAuthorizer(authorizer Authorizer, ownerAware auth.Rules) Authorizer {
+	return ownerAwareAuthorizer{authorizer: authorizer, ownerAware: ownerAware}
+}
+
+func ownerAware(access auth.Access, aware bool) auth.Access {
+	if access == auth.AccessOwner && !aware {
+		return auth.AccessDenied
+	}
+
+	return access
+}
+
+func (a ownerAwareAuthorizer) AuthorizeMethod(principal auth.Principal, fullMethod string) auth.Access {
+	return ownerAware(a.authorizer.AuthorizeMethod(principal, fullMethod), a.ownerAware.AllowsMethod(fullMethod))
+}
+
+func (a ownerAwareAuthorizer) AuthorizeRoute(principal auth.Principal, httpMethod, routePath string) auth.Access {
+	access := a.authorizer.AuthorizeRoute(principal, httpMethod, routePath)
+	return ownerAware(access, a.ownerAware.AllowsRoute(httpMethod, routePath))
+}
+
+// authorize applies the access decision to the context of the call.
+// Calls without a principal have passed an authentication exemption and are not authorized.
+func authorize(ctx context.Context, decide func(principal auth.Principal) auth.Access) (context.Context, error) {
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok {
+		return ctx, nil
+	}
+
+	switch decide(principal) {
+	case auth.AccessGranted:
+		return ctx, nil
+	case auth.AccessOwner:
+		return auth.WithOwnerOnly(ctx), nil
+	case auth.AccessDenied:
+		return nil, &models.PermissionDeniedError{Description: principal.Subject + " is not allowed to call this method"}
+	default:
+		return nil, &models.PermissionDeniedError{Description: "unknown access decision"}
+	}
+}
+
+func authorizationUnaryServerInterceptor(authorizer Authorizer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authorize(ctx, func(principal auth.Principal) auth.Access {
+			return authorizer.AuthorizeMethod(principal, info.FullMethod)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func authorizationStreamServerInterceptor(authorizer Authorizer) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorize(stream.Context(), func(principal auth.Principal) auth.Access {
+			return authorizer.AuthorizeMethod(principal, info.FullMethod)
+		})
+		if err != nil {
+			return err
+		}
+
+		wrapped := middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = ctx
+
+		return handler(srv, wrapped)
+	}
+}
+
+// credentials picks the token from "Authorization: Bearer <token>" or "X-Api-Key: <token>".
+func credentials(authorization, apiKey string) string {
+	if apiKey != "" {
+		return apiKey
+	}
+
+	scheme, token, found := strings.Cut(authorization, " ")
+	if !found || !strings.EqualFold(scheme, bearerScheme) {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
+
+func grpcAuthFunc(authenticator Authenticator) grpcauth.AuthFunc {
+	return func(ctx context.Context) (context.Context, error) {
+		method, _ := grpc.Method(ctx)
+		if authenticator.Exempt(method) {
+			return ctx, nil
+		}
+
+		md := metadata.ExtractIncoming(ctx)
+
+		principal, err := authenticator.Authenticate(credentials(md.Get(authorizationHeader), md.Get(apiKeyHeader)))
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+
+		return auth.WithPrincipal(ctx, principal), nil
+	}
+}
+
+// NewFiberAuth authenticates requests to the API routes, stores the principal in the user context
+// and, if authorizer is not nil, checks that the principal may request the route.
+func NewFiberAuth(authenticator Authenticator, authorizer Authorizer) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if authenticator.Exempt(ctx.Path()) {
+			return ctx.Next()
+		}
+
+		principal, err := authenticator.Authenticate(credentials(ctx.Get(fiber.HeaderAuthorization), ctx.Get(apiKeyHeader)))
+		if err != nil {
+			return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+		}
+
+		userCtx := auth.WithPrincipal(ctx.UserContext(), principal)
+
+		if authorizer != nil {
+			userCtx, err = authorize(userCtx, func(principal auth.Principal) auth.Access {
+				return authorizer.AuthorizeRoute(principal, ctx.Method(), ctx.Path())
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		ctx.SetUserContext(userCtx)
+
+		return ctx.Next()
+	}
+}
@@ -0,0 +1,45 @@
+package app_test
+
+import (
+	"testing"
+
+	eventDelivery "github.com/Inspirate789/grpc-template/internal/event/delivery"
+	"github.com/Inspirate789/grpc-template/internal/pkg/app"
+	"github.com/Inspirate789/grpc-template/internal/pkg/auth"
+)
+
+func TestOwnerAwareAuthorizer(t *testing.T) {
+	policy := &auth.Policy{
+		Roles: map[string]auth.Rules{"admin": {Methods: []string{"/event.EventService/*"}}},
+		Owner: auth.Rules{
+			Methods: []string{"/event.EventService/UpdateEvent", "/event.EventService/GetEvents", "/user.UserService/*"},
+			Routes:  []string{"PATCH /api/v1/events/*", "GET /api/v1/events"},
+		},
+	}
+	authorizer := app.NewOwnerAwareAuthorizer(policy, eventDelivery.OwnerAwareCalls("/api/v1"))
+	user := auth.Principal{Subject: "user", UserID: 1}
+
+	methods := map[string]auth.Access{
+		"/event.EventService/UpdateEvent": auth.AccessOwner,
+		"/event.EventService/GetEvents":   auth.AccessDenied,
+		"/user.UserService/DeleteUser":    auth.AccessDenied,
+	}
+	for method, want := range methods {
+		if access := authorizer.AuthorizeMethod(user, method); access != want {
+			t.Errorf("got access %d to %s, want %d", access, method, want)
+		}
+	}
+
+	if access := authorizer.AuthorizeRoute(user, "PATCH", "/api/v1/events/1"); access != auth.AccessOwner {
+		t.Errorf("got access %d to PATCH /api/v1/events/1, want the owner rule", access)
+	}
+
+	if access := authorizer.AuthorizeRoute(user, "GET", "/api/v1/events"); access != auth.AccessDenied {
+		t.Errorf("got access %d to GET /api/v1/events, want it denied", access)
+	}
+
+	admin := auth.Principal{Subject: "admin", Roles: []string{"admin"}}
+	if access := authorizer.AuthorizeMethod(admin, "/event.EventService/GetEvents"); access != auth.AccessGranted {
+		t.Errorf("got access %d of a role to GetEvents, want it granted", access)
+	}
+}
@@ -1,6 +1,10 @@
 package app
 
 import (
+	"github.com/Inspirate789/grpc-template/internal/pkg/auth"
+	"github.com/Inspirate789/grpc-template/internal/pkg/idempotency"
+	"github.com/Inspirate789/grpc-template/internal/pkg/tracing"
+	"github.com/Inspirate789/grpc-template/pkg/migrations"
 	"github.com/nil-go/konf"
 	"github.com/nil-go/konf/provider/env"
 	"github.com/nil-go/konf/provider/file"
@@ -11,9 +15,14 @@ type Config struct {
 	Logging struct {
 		Level int
 	}
-	Web  WebConfig
-	GRPC GrpcConfig
-	DB   struct {
+	Web         WebConfig
+	GRPC        GrpcConfig
+	Auth        auth.Config
+	Tracing     tracing.Config
+	Purge       PurgeConfig
+	Idempotency idempotency.Config
+	Migrations  migrations.Config
+	DB          struct {
 		DriverName       string
 		ConnectionString string
 	}
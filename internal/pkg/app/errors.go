@@ -0,0 +1,181 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/Inspirate789/grpc-template/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+const internalErrorMessage = "internal error"
+
+func withDetails(st *status.Status, details ...protoadapt.MessageV1) *status.Status {
+	res, err := st.WithDetails(details...)
+	if err != nil {
+		return st
+	}
+
+	return res
+}
+
+func fieldViolations(violations []models.FieldViolation) *errdetails.BadRequest {
+	res := &errdetails.BadRequest{
+		FieldViolations: make([]*errdetails.BadRequest_FieldViolation, 0, len(violations)),
+	}
+	for _, violation := range violations {
+		res.FieldViolations = append(res.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       violation.Field,
+			Description: violation.Description,
+		})
+	}
+
+	return res
+}
+
+func domainStatus(err error) (st *status.Status, httpCode int, ok bool) {
+	var (
+		notFound           *models.NotFoundError
+		alreadyExists      *models.AlreadyExistsError
+		invalidArgument    *models.InvalidArgumentError
+		failedPrecondition *models.FailedPreconditionError
+		conflict           *models.ConflictError
+		versionMismatch    *models.VersionMismatchError
+		resourceExhausted  *models.ResourceExhaustedError
+		permissionDenied   *models.PermissionDeniedError
+	)
+
+	switch {
+	case errors.As(err, &notFound):
+		return withDetails(status.New(codes.NotFound, notFound.Error()), &errdetails.ResourceInfo{
+			ResourceType: notFound.Resource,
+			ResourceName: notFound.Name,
+			Description:  notFound.Error(),
+		}), fiber.StatusNotFound, true
+	case errors.As(err, &alreadyExists):
+		return withDetails(status.New(codes.AlreadyExists, alreadyExists.Error()), &errdetails.ResourceInfo{
+			ResourceType: alreadyExists.Resource,
+			ResourceName: alreadyExists.Name,
+			Description:  alreadyExists.Error(),
+		}), fiber.StatusConflict, true
+	case errors.As(err, &invalidArgument):
+		return withDetails(
+			status.New(codes.InvalidArgument, invalidArgument.Error()),
+			fieldViolations(invalidArgument.Violations),
+		), fiber.StatusBadRequest, true
+	case errors.As(err, &failedPrecondition):
+		return withDetails(status.New(codes.FailedPrecondition, failedPrecondition.Error()), &errdetails.PreconditionFailure{
+			Violations: []*errdetails.PreconditionFailure_Violation{{
+				Type:        "STATE",
+				Subject:     failedPrecondition.Subject,
+				Description: failedPrecondition.Description,
+			}},
+		}), fiber.StatusBadRequest, true
+	case errors.As(err, &conflict):
+		return withDetails(status.New(codes.Aborted, conflict.Error()), &errdetails.ResourceInfo{
+			ResourceType: conflict.Resource,
+			ResourceName: conflict.Name,
+			Description:  conflict.Description,
+		}), fiber.StatusConflict, true
+	case errors.As(err, &versionMismatch):
+		return withDetails(status.New(codes.Aborted, versionMismatch.Error()), &errdetails.ResourceInfo{
+			ResourceType: versionMismatch.Resource,
+			ResourceName: versionMismatch.Name,
+			Description:  versionMismatch.Error(),
+		}), fiber.StatusPreconditionFailed, true
+	case errors.As(err, &resourceExhausted):
+		return status.New(codes.ResourceExhausted, resourceExhausted.Error()), fiber.StatusTooManyRequests, true
+	case errors.As(err, &permissionDenied):
+		st := status.New(codes.PermissionDenied, permissionDenied.Error())
+		if permissionDenied.Resource != "" {
+			st = withDetails(st, &errdetails.ResourceInfo{
+				ResourceType: permissionDenied.Resource,
+				ResourceName: permissionDenied.Name,
+				Description:  permissionDenied.Description,
+			})
+		}
+
+		return st, fiber.StatusForbidden, true
+	default:
+		return nil, 0, false
+	}
+}
+
+// ErrorStatus converts err into a gRPC status the way the server interceptors do,
+// except that it doesn't log unexpected errors. It suits per-item results of batch calls.
+func ErrorStatus(err error) *status.Status {
+	if st, ok := status.FromError(err); ok {
+		return st
+	}
+
+	if st, _, ok := domainStatus(err); ok {
+		return st
+	}
+
+	return status.New(codes.Internal, internalErrorMessage)
+}
+
+func grpcError(ctx context.Context, err error, logger *slog.Logger) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	if st, _, ok := domainStatus(err); ok {
+		return st.Err()
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return status.Error(codes.Canceled, err.Error())
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+
+	logger.ErrorContext(ctx, err.Error())
+
+	return status.Error(codes.Internal, internalErrorMessage)
+}
+
+func errorUnaryServerInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		res, err := handler(ctx, req)
+
+		return res, grpcError(ctx, err, logger)
+	}
+}
+
+func errorStreamServerInterceptor(logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return grpcError(stream.Context(), handler(srv, stream), logger)
+	}
+}
+
+func fiberDomainError(ctx *fiber.Ctx, err error) (bool, error) {
+	st, code, ok := domainStatus(err)
+	if !ok {
+		return false, nil
+	}
+
+	body := newFiberError(st.Message())
+
+	var invalidArgument *models.InvalidArgumentError
+	if errors.As(err, &invalidArgument) {
+		violations := make([]fiber.Map, 0, len(invalidArgument.Violations))
+		for _, violation := range invalidArgument.Violations {
+			violations = append(violations, fiber.Map{"field": violation.Field, "description": violation.Description})
+		}
+
+		body["violations"] = violations
+	}
+
+	return true, ctx.Status(code).JSON(body)
+}
@@ -0,0 +1,35 @@
+package app
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SetETag sets the ETag header of the response to the version of the returned resource.
+func SetETag(ctx *fiber.Ctx, version uint64) {
+	ctx.Set(fiber.HeaderETag, `"`+strconv.FormatUint(version, 10)+`"`)
+}
+
+// IfMatch returns the version required by the If-Match header of the request.
+// It returns zero if the header is absent or "*", so the change applies to any version.
+// Only a single strong entity tag previously returned in ETag is accepted.
+func IfMatch(ctx *fiber.Ctx) (uint64, error) {
+	header := strings.TrimSpace(ctx.Get(fiber.HeaderIfMatch))
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+
+	tag, ok := strings.CutPrefix(header, `"`)
+	if ok {
+		tag, ok = strings.CutSuffix(tag, `"`)
+	}
+
+	version, err := strconv.ParseUint(tag, 10, 64)
+	if !ok || err != nil || version == 0 {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "invalid If-Match header: expected an entity tag returned in ETag")
+	}
+
+	return version, nil
+}
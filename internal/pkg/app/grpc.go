@@ -6,12 +6,17 @@ import (
 	"log/slog"
 	"net"
 	"runtime/debug"
+	"time"
 
+	middleware "github.com/grpc-ecosystem/go-grpc-middleware/v2"
+	grpcauth "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/auth"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/recovery"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 )
@@ -19,26 +24,63 @@ import (
 type GrpcDelivery interface {
 	HealthChecker
 	Register(registry grpc.ServiceRegistrar)
+	ServiceName() string
 }
 
 type GrpcConfig struct {
-	Host string
-	Port string
+	Host                string
+	Port                string
+	HealthCheckInterval time.Duration
 }
 
 type GrpcApp struct {
-	config GrpcConfig
-	server *grpc.Server
-	logger *slog.Logger
+	config      GrpcConfig
+	server      *grpc.Server
+	health      *health.Server
+	delivery    []GrpcDelivery
+	shutdown    context.CancelFunc
+	shutdownCtx context.Context
+	logger      *slog.Logger
 }
 
+const defaultHealthCheckInterval = 5 * time.Second
+
+// InterceptorLogger logs with the call context, so a logger built on tracing.LogHandler
+// adds the trace and span ids of the call to the records.
 func InterceptorLogger(logger *slog.Logger) logging.Logger {
 	return logging.LoggerFunc(func(ctx context.Context, level logging.Level, msg string, fields ...any) {
 		logger.Log(ctx, slog.Level(level), msg, fields...)
 	})
 }
 
-func NewGrpcApp(config GrpcConfig, logger *slog.Logger, delivery ...GrpcDelivery) *GrpcApp {
+// shutdownStreamServerInterceptor cancels long-lived streams when the app shuts down,
+// so GracefulStop does not wait for watchers to disconnect.
+func shutdownStreamServerInterceptor(shutdownCtx context.Context) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, cancel := context.WithCancel(stream.Context())
+		defer cancel()
+
+		stop := context.AfterFunc(shutdownCtx, cancel)
+		defer stop()
+
+		wrapped := middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = ctx
+
+		return handler(srv, wrapped)
+	}
+}
+
+// NewGrpcApp creates the gRPC server. A nil authenticator leaves all methods unauthenticated,
+// a nil authorizer lets every authenticated principal call any method.
+func NewGrpcApp(
+	config GrpcConfig,
+	validator Validator,
+	authenticator Authenticator,
+	authorizer Authorizer,
+	metrics *Metrics,
+	logger *slog.Logger,
+	delivery ...GrpcDelivery,
+) *GrpcApp {
 	recoveryOpt := recovery.WithRecoveryHandlerContext(
 		func(ctx context.Context, p interface{}) error {
 			logger.ErrorContext(ctx, fmt.Sprintf("panic: %s\n\n%s", p, string(debug.Stack())))
@@ -46,28 +88,108 @@ func NewGrpcApp(config GrpcConfig, logger *slog.Logger, delivery ...GrpcDelivery
 		},
 	)
 
+	shutdownCtx, shutdown := context.WithCancel(context.Background())
+
+	unaryInterceptors := []grpc.UnaryServerInterceptor{
+		logging.UnaryServerInterceptor(InterceptorLogger(logger)),
+	}
+	streamInterceptors := []grpc.StreamServerInterceptor{
+		logging.StreamServerInterceptor(InterceptorLogger(logger)),
+	}
+
+	if metrics != nil {
+		unaryInterceptors = append(unaryInterceptors, metrics.grpc.UnaryServerInterceptor())
+		streamInterceptors = append(streamInterceptors, metrics.grpc.StreamServerInterceptor())
+	}
+
+	unaryInterceptors = append(unaryInterceptors, recovery.UnaryServerInterceptor(recoveryOpt))
+	streamInterceptors = append(streamInterceptors,
+		shutdownStreamServerInterceptor(shutdownCtx),
+		recovery.StreamServerInterceptor(recoveryOpt),
+	)
+
+	if authenticator != nil {
+		unaryInterceptors = append(unaryInterceptors, grpcauth.UnaryServerInterceptor(grpcAuthFunc(authenticator)))
+		streamInterceptors = append(streamInterceptors, grpcauth.StreamServerInterceptor(grpcAuthFunc(authenticator)))
+	}
+
+	unaryInterceptors = append(unaryInterceptors, errorUnaryServerInterceptor(logger), idempotencyUnaryServerInterceptor())
+	streamInterceptors = append(streamInterceptors, errorStreamServerInterceptor(logger))
+
+	if authorizer != nil {
+		unaryInterceptors = append(unaryInterceptors, authorizationUnaryServerInterceptor(authorizer))
+		streamInterceptors = append(streamInterceptors, authorizationStreamServerInterceptor(authorizer))
+	}
+
 	serverOpts := []grpc.ServerOption{
-		grpc.ChainUnaryInterceptor(
-			logging.UnaryServerInterceptor(InterceptorLogger(logger)),
-			recovery.UnaryServerInterceptor(recoveryOpt),
-		),
-		grpc.ChainStreamInterceptor(
-			logging.StreamServerInterceptor(InterceptorLogger(logger)),
-			recovery.StreamServerInterceptor(recoveryOpt),
-		),
+		grpcTracing(),
+		grpc.ChainUnaryInterceptor(append(unaryInterceptors, validationUnaryServerInterceptor(validator))...),
+		grpc.ChainStreamInterceptor(append(streamInterceptors, validationStreamServerInterceptor(validator))...),
 	}
 
 	server := grpc.NewServer(serverOpts...)
 	reflection.Register(server)
 
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+
 	for _, d := range delivery {
 		d.Register(server)
+		healthServer.SetServingStatus(d.ServiceName(), healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+
+	if metrics != nil {
+		metrics.grpc.InitializeMetrics(server)
+	}
+
+	if config.HealthCheckInterval <= 0 {
+		config.HealthCheckInterval = defaultHealthCheckInterval
 	}
 
 	return &GrpcApp{
-		config: config,
-		server: server,
-		logger: logger,
+		config:      config,
+		server:      server,
+		health:      healthServer,
+		delivery:    delivery,
+		shutdown:    shutdown,
+		shutdownCtx: shutdownCtx,
+		logger:      logger,
+	}
+}
+
+func (app *GrpcApp) checkHealth(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, app.config.HealthCheckInterval)
+	defer cancel()
+
+	overall := healthpb.HealthCheckResponse_SERVING
+
+	for _, d := range app.delivery {
+		servingStatus := healthpb.HealthCheckResponse_SERVING
+
+		err := d.HealthCheck(ctx)
+		if err != nil {
+			app.logger.WarnContext(ctx, fmt.Sprintf("health check of %s failed: %v", d.ServiceName(), err))
+			servingStatus = healthpb.HealthCheckResponse_NOT_SERVING
+			overall = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+
+		app.health.SetServingStatus(d.ServiceName(), servingStatus)
+	}
+
+	app.health.SetServingStatus("", overall)
+}
+
+func (app *GrpcApp) pollHealth() {
+	ticker := time.NewTicker(app.config.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-app.shutdownCtx.Done():
+			return
+		case <-ticker.C:
+			app.checkHealth(app.shutdownCtx)
+		}
 	}
 }
 
@@ -77,9 +199,27 @@ func (app *GrpcApp) Start() error {
 		return errors.Wrap(err, "listen tcp")
 	}
 
+	app.checkHealth(app.shutdownCtx)
+	go app.pollHealth()
+
 	return errors.Wrap(app.server.Serve(listener), "start grpc app")
 }
 
-func (app *GrpcApp) Shutdown() {
-	app.server.GracefulStop()
+func (app *GrpcApp) Shutdown(ctx context.Context) error {
+	app.health.Shutdown()
+	app.shutdown()
+
+	stopped := make(chan struct{})
+	go func() {
+		app.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		app.server.Stop()
+		return errors.Wrap(ctx.Err(), "stop grpc app")
+	}
 }
@@ -0,0 +1,46 @@
+package app
+
+import (
+	"context"
+
+	"github.com/Inspirate789/grpc-template/internal/pkg/idempotency"
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// idempotencyUnaryServerInterceptor passes the idempotency-key metadata to usecases through the context.
+func idempotencyUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		values := metadata.ValueFromIncomingContext(ctx, idempotency.Header)
+		if len(values) == 0 {
+			return handler(ctx, req)
+		}
+
+		err := idempotency.ValidateKey(values[0])
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(idempotency.WithKey(ctx, values[0]), req)
+	}
+}
+
+// fiberIdempotency passes the Idempotency-Key header to usecases through the user context.
+func fiberIdempotency() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		key := ctx.Get(idempotency.Header)
+		if key == "" {
+			return ctx.Next()
+		}
+
+		err := idempotency.ValidateKey(key)
+		if err != nil {
+			return err
+		}
+
+		ctx.SetUserContext(idempotency.WithKey(ctx.UserContext(), key))
+
+		return ctx.Next()
+	}
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	grpcprom "github.com/grpc-ecosystem/go-grpc-middleware/providers/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics holds the registry served on /metrics along with the RED metrics of gRPC methods and HTTP routes.
+type Metrics struct {
+	registry     *prometheus.Registry
+	grpc         *grpcprom.ServerMetrics
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+}
+
+func NewMetrics() (*Metrics, error) {
+	registry := prometheus.NewRegistry()
+
+	grpcMetrics := grpcprom.NewServerMetrics(grpcprom.WithServerHandlingTimeHistogram(
+		grpcprom.WithHistogramBuckets(prometheus.DefBuckets),
+	))
+
+	httpRequests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_server_requests_total",
+		Help: "Total number of HTTP requests completed on the server.",
+	}, []string{"method", "route", "code"})
+
+	httpDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_server_request_duration_seconds",
+		Help:    "Duration of HTTP requests completed on the server.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	for _, collector := range []prometheus.Collector{
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		grpcMetrics,
+		httpRequests,
+		httpDuration,
+	} {
+		err := registry.Register(collector)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Metrics{
+		registry:     registry,
+		grpc:         grpcMetrics,
+		httpRequests: httpRequests,
+		httpDuration: httpDuration,
+	}, nil
+}
+
+// Registerer lets other layers, e.g. the database, add their metrics to the /metrics endpoint.
+func (m *Metrics) Registerer() prometheus.Registerer {
+	return m.registry
+}
+
+func (m *Metrics) handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
+
+// fiberMiddleware records requests by route pattern, so path parameters don't blow up the label set.
+// It must run outside of the logger middleware, which turns handler errors into responses.
+func (m *Metrics) fiberMiddleware() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		start := time.Now()
+
+		err := ctx.Next()
+
+		method := ctx.Method()
+		route := ctx.Route().Path
+		code := strconv.Itoa(ctx.Response().StatusCode())
+
+		m.httpRequests.WithLabelValues(method, route, code).Inc()
+		m.httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
@@ -0,0 +1,106 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// PurgeTarget hard-deletes its rows soft-deleted before the given time.
+type PurgeTarget interface {
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+}
+
+type PurgeConfig struct {
+	// Retention is how long soft-deleted rows can be restored; zero disables purging.
+	Retention time.Duration
+	Interval  time.Duration
+}
+
+// Purger periodically hard-deletes rows that have been soft-deleted for longer than the retention.
+type Purger struct {
+	config      PurgeConfig
+	targets     []PurgeTarget
+	shutdown    context.CancelFunc
+	shutdownCtx context.Context
+	done        chan struct{}
+	logger      *slog.Logger
+}
+
+const defaultPurgeInterval = time.Hour
+
+func NewPurger(config PurgeConfig, logger *slog.Logger, targets ...PurgeTarget) *Purger {
+	if config.Interval <= 0 {
+		config.Interval = defaultPurgeInterval
+	}
+
+	shutdownCtx, shutdown := context.WithCancel(context.Background())
+
+	return &Purger{
+		config:      config,
+		targets:     targets,
+		shutdown:    shutdown,
+		shutdownCtx: shutdownCtx,
+		done:        make(chan struct{}),
+		logger:      logger,
+	}
+}
+
+func (p *Purger) purge() {
+	ctx, cancel := context.WithTimeout(p.shutdownCtx, p.config.Interval)
+	defer cancel()
+
+	before := time.Now().Add(-p.config.Retention)
+
+	var total int64
+
+	for _, target := range p.targets {
+		purged, err := target.PurgeDeleted(ctx, before)
+		if err != nil {
+			p.logger.ErrorContext(ctx, "purge deleted rows: "+err.Error())
+			continue
+		}
+
+		total += purged
+	}
+
+	if total != 0 {
+		p.logger.InfoContext(ctx, fmt.Sprintf("purged %d rows deleted before %s", total, before.Format(time.RFC3339)))
+	}
+}
+
+// Start purges right away and then every interval until Shutdown.
+func (p *Purger) Start() {
+	defer close(p.done)
+
+	if p.config.Retention <= 0 {
+		p.logger.Info("purging of deleted rows is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge()
+
+		select {
+		case <-p.shutdownCtx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shutdown interrupts the current purge and waits for Start to return.
+func (p *Purger) Shutdown(ctx context.Context) error {
+	p.shutdown()
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc/filters"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+const tracerName = "github.com/Inspirate789/grpc-template/internal/pkg/app"
+
+// grpcTracing continues traces from the incoming metadata with a span per call, except for health checks.
+func grpcTracing() grpc.ServerOption {
+	return grpc.StatsHandler(otelgrpc.NewServerHandler(
+		otelgrpc.WithFilter(filters.Not(filters.HealthCheck())),
+	))
+}
+
+// fiberTracing continues traces from the request headers with a span per request and puts it
+// into the user context. Like the metrics it must run outside of the logger middleware.
+func fiberTracing() fiber.Handler {
+	tracer := otel.Tracer(tracerName)
+
+	return func(ctx *fiber.Ctx) error {
+		carrier := propagation.HeaderCarrier(http.Header(ctx.GetReqHeaders()))
+		userCtx := otel.GetTextMapPropagator().Extract(ctx.UserContext(), carrier)
+
+		userCtx, span := tracer.Start(userCtx, ctx.Method()+" "+ctx.Path(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(ctx.Method()),
+				semconv.URLPath(ctx.Path()),
+			),
+		)
+		defer span.End()
+
+		ctx.SetUserContext(userCtx)
+
+		err := ctx.Next()
+
+		route := ctx.Route().Path
+		code := ctx.Response().StatusCode()
+
+		span.SetName(ctx.Method() + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route), semconv.HTTPResponseStatusCode(code))
+
+		if code >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(code))
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+type Validator interface {
+	Validate(msg proto.Message) error
+}
+
+type validatingServerStream struct {
+	grpc.ServerStream
+	validator Validator
+}
+
+func (s *validatingServerStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err != nil {
+		return err
+	}
+
+	if msg, ok := m.(proto.Message); ok {
+		return s.validator.Validate(msg)
+	}
+
+	return nil
+}
+
+func validationUnaryServerInterceptor(validator Validator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if msg, ok := req.(proto.Message); ok {
+			err := validator.Validate(msg)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func validationStreamServerInterceptor(validator Validator) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &validatingServerStream{ServerStream: stream, validator: validator})
+	}
+}
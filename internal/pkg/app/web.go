@@ -58,25 +58,41 @@ func NewWebApp(
 	config WebConfig,
 	delivery []WebDelivery,
 	auth fiber.Handler,
+	metrics *Metrics,
 	logger *slog.Logger,
 	appComponents ...HealthChecker,
 ) *WebApp {
 	app := fiber.New(fiber.Config{
 		DisableStartupMessage: true,
 		ErrorHandler: func(ctx *fiber.Ctx, err error) error {
+			var fiberError *fiber.Error
+			if errors.As(err, &fiberError) {
+				return ctx.Status(fiberError.Code).JSON(newFiberError(fiberError.Message))
+			}
+
+			if handled, handlerErr := fiberDomainError(ctx, err); handled {
+				return handlerErr
+			}
+
 			logger.Error(err.Error())
-			msg := strings.SplitN(err.Error(), ":", 2)[0]
 
 			var DNSError *net.DNSError
 			if errors.As(err, &DNSError) {
+				msg := strings.SplitN(err.Error(), ":", 2)[0]
 				return ctx.Status(fiber.StatusServiceUnavailable).JSON(newFiberError(msg))
 			}
 
-			return ctx.Status(fiber.StatusInternalServerError).JSON(newFiberError(msg))
+			return ctx.Status(fiber.StatusInternalServerError).JSON(newFiberError(internalErrorMessage))
 		},
 	})
 
 	app.Use(recover.New(recover.Config{EnableStackTrace: true}))
+
+	if metrics != nil {
+		app.Use(metrics.fiberMiddleware())
+	}
+
+	app.Use(fiberTracing())
 	app.Use(slogfiber.New(logger))
 	app.Use(pprof.New())
 
@@ -86,6 +102,8 @@ func NewWebApp(
 		api.Use(auth)
 	}
 
+	api.Use(fiberIdempotency())
+
 	for _, d := range delivery {
 		appComponents = append(appComponents, d)
 		d.AddHandlers(api)
@@ -93,6 +111,10 @@ func NewWebApp(
 
 	app.Get("/manage/health", checkReadiness(appComponents...))
 
+	if metrics != nil {
+		app.Get("/metrics", metrics.handler())
+	}
+
 	return &WebApp{
 		config: config,
 		app:    app,
@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/MicahParks/keyfunc/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrNoCredentials      = errors.New("missing credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+type Principal struct {
+	Subject string
+	Roles   []string
+	// UserID links the principal to a user for ownership checks, zero if it isn't a user.
+	UserID uint64
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the caller authenticated by the transport, if any.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+type JWTConfig struct {
+	// Secret is the HS256 key; prefer setting it through AUTH_JWT_SECRET.
+	Secret string
+	// JWKSFile holds RS256 public keys or HS256 "oct" keys selected by the kid header.
+	JWKSFile    string
+	Issuer      string
+	Audience    string
+	RolesClaim  string
+	UserIDClaim string
+}
+
+// redacted replaces secrets in the printed config.
+const redacted = "[REDACTED]"
+
+// String hides the secret, so the config can be logged.
+func (c JWTConfig) String() string {
+	if c.Secret != "" {
+		c.Secret = redacted
+	}
+
+	type jwtConfig JWTConfig
+
+	return fmt.Sprintf("%+v", jwtConfig(c))
+}
+
+type APIKeyConfig struct {
+	Subject string
+	// SHA256 is the hex-encoded hash of the key, so the key itself never lands in the config.
+	SHA256 string
+	Roles  []string
+}
+
+// String hides the key hash, so the config can be logged.
+func (c APIKeyConfig) String() string {
+	c.SHA256 = redacted
+
+	type apiKeyConfig APIKeyConfig
+
+	return fmt.Sprintf("%+v", apiKeyConfig(c))
+}
+
+type Config struct {
+	Enabled bool
+	// PolicyFile maps roles to the methods and routes they may call; without it
+	// every authenticated principal may call everything.
+	PolicyFile string
+	JWT        JWTConfig
+	APIKeys    []APIKeyConfig
+	// Exempt lists prefixes of full gRPC method names and HTTP paths served without credentials,
+	// e.g. "/grpc.health.v1.Health/".
+	Exempt []string
+}
+
+type apiKey struct {
+	hash      []byte
+	principal Principal
+}
+
+type Authenticator struct {
+	keyfunc     jwt.Keyfunc
+	parser      *jwt.Parser
+	rolesClaim  string
+	userIDClaim string
+	apiKeys     []apiKey
+	exempt      []string
+}
+
+const (
+	defaultRolesClaim  = "roles"
+	defaultUserIDClaim = "user_id"
+)
+
+func newJWKSKeyfunc(path string) (jwt.Keyfunc, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read jwks file")
+	}
+
+	keys, err := keyfunc.NewJWKSetJSON(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse jwks file")
+	}
+
+	return keys.Keyfunc, nil
+}
+
+func New(config Config) (*Authenticator, error) {
+	var keys jwt.Keyfunc
+
+	switch {
+	case config.JWT.JWKSFile != "":
+		var err error
+
+		keys, err = newJWKSKeyfunc(config.JWT.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+	case config.JWT.Secret != "":
+		secret := []byte(config.JWT.Secret)
+		keys = func(*jwt.Token) (any, error) { return secret, nil }
+	}
+
+	apiKeys := make([]apiKey, 0, len(config.APIKeys))
+	for _, key := range config.APIKeys {
+		hash, err := hex.DecodeString(key.SHA256)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, errors.Errorf("invalid sha256 of api key for %q", key.Subject)
+		}
+
+		apiKeys = append(apiKeys, apiKey{
+			hash:      hash,
+			principal: Principal{Subject: key.Subject, Roles: key.Roles},
+		})
+	}
+
+	if keys == nil && len(apiKeys) == 0 {
+		return nil, errors.New("neither jwt keys nor api keys are configured")
+	}
+
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	}
+	if config.JWT.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(config.JWT.Issuer))
+	}
+
+	if config.JWT.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(config.JWT.Audience))
+	}
+
+	rolesClaim := config.JWT.RolesClaim
+	if rolesClaim == "" {
+		rolesClaim = defaultRolesClaim
+	}
+
+	userIDClaim := config.JWT.UserIDClaim
+	if userIDClaim == "" {
+		userIDClaim = defaultUserIDClaim
+	}
+
+	return &Authenticator{
+		keyfunc:     keys,
+		parser:      jwt.NewParser(parserOpts...),
+		rolesClaim:  rolesClaim,
+		userIDClaim: userIDClaim,
+		apiKeys:     apiKeys,
+		exempt:      config.Exempt,
+	}, nil
+}
+
+// Exempt reports whether the gRPC method or HTTP path is served without credentials.
+func (a *Authenticator) Exempt(method string) bool {
+	for _, prefix := range a.exempt {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authenticate resolves the principal of an API key or a signed JWT.
+func (a *Authenticator) Authenticate(token string) (Principal, error) {
+	if token == "" {
+		return Principal{}, ErrNoCredentials
+	}
+
+	hash := sha256.Sum256([]byte(token))
+	for _, key := range a.apiKeys {
+		if subtle.ConstantTimeCompare(hash[:], key.hash) == 1 {
+			return key.principal, nil
+		}
+	}
+
+	if a.keyfunc == nil {
+		return Principal{}, ErrInvalidCredentials
+	}
+
+	claims := jwt.MapClaims{}
+
+	_, err := a.parser.ParseWithClaims(token, claims, a.keyfunc)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return Principal{}, fmt.Errorf("%w: token has no subject", ErrInvalidCredentials)
+	}
+
+	return Principal{Subject: subject, Roles: a.roles(claims), UserID: a.userID(claims)}, nil
+}
+
+func (a *Authenticator) roles(claims jwt.MapClaims) []string {
+	values, _ := claims[a.rolesClaim].([]any)
+
+	roles := make([]string, 0, len(values))
+	for _, value := range values {
+		if role, ok := value.(string); ok {
+			roles = append(roles, role)
+		}
+	}
+
+	return roles
+}
+
+func (a *Authenticator) userID(claims jwt.MapClaims) uint64 {
+	switch value := claims[a.userIDClaim].(type) {
+	case float64:
+		if value > 0 && value == math.Trunc(value) {
+			return uint64(value)
+		}
+	case string:
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err == nil {
+			return id
+		}
+	}
+
+	return 0
+}
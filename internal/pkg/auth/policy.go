@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+type Access int
+
+const (
+	AccessDenied Access = iota
+	// AccessOwner lets the call through on the condition that the principal owns the resource,
+	// which the usecase checks in the transaction changing the resource.
+	AccessOwner
+	AccessGranted
+)
+
+// Rules holds path.Match patterns of full gRPC method names ("/user.UserService/*")
+// and HTTP routes ("GET /api/v1/users/*", "*" matches any HTTP method).
+type Rules struct {
+	Methods []string `yaml:"methods"`
+	Routes  []string `yaml:"routes"`
+}
+
+type Policy struct {
+	Roles map[string]Rules `yaml:"roles"`
+	Owner Rules            `yaml:"owner"`
+}
+
+func LoadPolicy(policyPath string) (*Policy, error) {
+	raw, err := os.ReadFile(policyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "read policy file")
+	}
+
+	var policy Policy
+
+	err = yaml.Unmarshal(raw, &policy)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse policy file")
+	}
+
+	for _, rules := range policy.Roles {
+		err = rules.validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = policy.Owner.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+func (r Rules) validate() error {
+	for _, pattern := range r.Methods {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, "method pattern %q", pattern)
+		}
+	}
+
+	for _, route := range r.Routes {
+		method, pattern, found := strings.Cut(route, " ")
+		if !found || method == "" {
+			return errors.Errorf("route %q must look like \"<HTTP method> <path pattern>\"", route)
+		}
+
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, "route pattern %q", route)
+		}
+	}
+
+	return nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowsMethod reports whether the full gRPC method name matches the rules.
+func (r Rules) AllowsMethod(fullMethod string) bool {
+	return matchAny(r.Methods, fullMethod)
+}
+
+// AllowsRoute reports whether the HTTP method and path match the rules.
+func (r Rules) AllowsRoute(httpMethod, routePath string) bool {
+	if len(routePath) > 1 {
+		routePath = strings.TrimSuffix(routePath, "/")
+	}
+
+	for _, route := range r.Routes {
+		method, pattern, _ := strings.Cut(route, " ")
+		if method != "*" && !strings.EqualFold(method, httpMethod) {
+			continue
+		}
+
+		if ok, _ := path.Match(pattern, routePath); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Policy) access(principal Principal, allows func(rules Rules) bool) Access {
+	for _, role := range principal.Roles {
+		if rules, ok := p.Roles[role]; ok && allows(rules) {
+			return AccessGranted
+		}
+	}
+
+	if principal.UserID != 0 && allows(p.Owner) {
+		return AccessOwner
+	}
+
+	return AccessDenied
+}
+
+// AuthorizeMethod decides whether the principal may call the full gRPC method name.
+func (p *Policy) AuthorizeMethod(principal Principal, fullMethod string) Access {
+	return p.access(principal, func(rules Rules) bool { return rules.AllowsMethod(fullMethod) })
+}
+
+// AuthorizeRoute decides whether the principal may request the HTTP route.
+func (p *Policy) AuthorizeRoute(principal Principal, httpMethod, routePath string) Access {
+	return p.access(principal, func(rules Rules) bool { return rules.AllowsRoute(httpMethod, routePath) })
+}
+
+type ownerOnlyKey struct{}
+
+// WithOwnerOnly marks the call as allowed only for owners of the resource it touches.
+func WithOwnerOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ownerOnlyKey{}, true)
+}
+
+func OwnerOnly(ctx context.Context) bool {
+	ownerOnly, _ := ctx.Value(ownerOnlyKey{}).(bool)
+	return ownerOnly
+}
@@ -0,0 +1,365 @@
+// Package dump exports users, events, their memberships and changed occurrences as a stream of records
+// and imports them back, keeping ids, versions and soft deletion.
+package dump
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/Inspirate789/grpc-template/pkg/sqlxutils"
+)
+
+type RecordType string
+
+// Records are exported in this order of types, so the rows they reference are imported first.
+const (
+	TypeUser       RecordType = "user"
+	TypeEvent      RecordType = "event"
+	TypeMembership RecordType = "membership"
+	TypeOccurrence RecordType = "occurrence"
+)
+
+// Record is a row of one of the tables; the fields that don't belong to its type are empty.
+// Timestamps are RFC 3339 UTC times.
+type Record struct {
+	Type         RecordType `json:"type"`
+	ID           uint64     `json:"id,omitempty"            db:"id"`
+	Name         string     `json:"name,omitempty"          db:"name"`
+	Timestamp    string     `json:"timestamp,omitempty"     db:"timestamp"`
+	RRule        *string    `json:"rrule,omitempty"         db:"rrule"`
+	TimeZone     *string    `json:"time_zone,omitempty"     db:"time_zone"`
+	ExDates      *string    `json:"exdates,omitempty"       db:"exdates"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"    db:"deleted_at"`
+	Version      uint64     `json:"version,omitempty"       db:"version"`
+	UserID       uint64     `json:"user_id,omitempty"       db:"user_id"`
+	EventID      uint64     `json:"event_id,omitempty"      db:"event_id"`
+	RecurrenceID string     `json:"recurrence_id,omitempty" db:"recurrence_id"`
+}
+
+// Stats counts records by type.
+type Stats map[RecordType]uint64
+
+// DefaultBatchSize is the page size of exported tables and the default number of records imported in one transaction.
+const DefaultBatchSize = 1000
+
+// normalizeTime formats a timestamp read from a database or a dump the way the repositories store it.
+func normalizeTime(value string) (string, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return "", err
+	}
+
+	return t.UTC().Format(time.RFC3339), nil
+}
+
+func (r *Record) normalize() error {
+	var err error
+
+	if r.Timestamp != "" {
+		r.Timestamp, err = normalizeTime(r.Timestamp)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp: %w", err)
+		}
+	}
+
+	if r.RecurrenceID != "" {
+		r.RecurrenceID, err = normalizeTime(r.RecurrenceID)
+		if err != nil {
+			return fmt.Errorf("invalid recurrence_id: %w", err)
+		}
+	}
+
+	if r.DeletedAt != nil {
+		deletedAt := r.DeletedAt.UTC()
+		r.DeletedAt = &deletedAt
+	}
+
+	return nil
+}
+
+// validate reports records missing the fields required by their type.
+func (r *Record) validate() error {
+	var missing string
+
+	switch r.Type {
+	case TypeUser:
+		if r.ID == 0 {
+			missing = "id"
+		}
+	case TypeEvent:
+		if r.ID == 0 {
+			missing = "id"
+		} else if r.Timestamp == "" {
+			missing = "timestamp"
+		}
+	case TypeMembership:
+		if r.UserID == 0 {
+			missing = "user_id"
+		} else if r.EventID == 0 {
+			missing = "event_id"
+		}
+	case TypeOccurrence:
+		if r.EventID == 0 {
+			missing = "event_id"
+		} else if r.RecurrenceID == "" {
+			missing = "recurrence_id"
+		} else if r.Timestamp == "" {
+			missing = "timestamp"
+		}
+	default:
+		return fmt.Errorf("unknown record type %q", r.Type)
+	}
+
+	if missing != "" {
+		return fmt.Errorf("%s record without %s", r.Type, missing)
+	}
+
+	if r.Version == 0 && (r.Type == TypeUser || r.Type == TypeEvent) {
+		r.Version = 1
+	}
+
+	return r.normalize()
+}
+
+// exportTable writes the rows of a table selected in pages by selectPage.
+func exportTable(
+	w Writer,
+	recordType RecordType,
+	selectPage func(after Record) ([]Record, error),
+) (uint64, error) {
+	var (
+		after Record
+		count uint64
+	)
+
+	for {
+		page, err := selectPage(after)
+		if err != nil {
+			return count, err
+		}
+
+		for _, record := range page {
+			record.Type = recordType
+
+			err = record.normalize()
+			if err != nil {
+				return count, err
+			}
+
+			err = w.Write(record)
+			if err != nil {
+				return count, err
+			}
+
+			count++
+		}
+
+		if len(page) < DefaultBatchSize {
+			return count, nil
+		}
+
+		after = page[len(page)-1]
+	}
+}
+
+// Export writes all records to w. The tables are read in one transaction, so the records are consistent
+// even if the app changes them at the same time.
+func Export(ctx context.Context, db *sqlxutils.DB, w Writer) (Stats, error) {
+	stats := make(Stats)
+
+	err := sqlxutils.RunTx(ctx, db, sql.LevelRepeatableRead, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		tables := []struct {
+			recordType RecordType
+			selectPage func(after Record) ([]Record, error)
+		}{
+			{TypeUser, func(after Record) ([]Record, error) {
+				page := make([]Record, 0, DefaultBatchSize)
+				return page, sqlxutils.Select(ctx, tx, &page, selectUsersQuery, after.ID, DefaultBatchSize)
+			}},
+			{TypeEvent, func(after Record) ([]Record, error) {
+				page := make([]Record, 0, DefaultBatchSize)
+				return page, sqlxutils.Select(ctx, tx, &page, selectEventsQuery, after.ID, DefaultBatchSize)
+			}},
+			{TypeMembership, func(after Record) ([]Record, error) {
+				page := make([]Record, 0, DefaultBatchSize)
+				return page, sqlxutils.Select(ctx, tx, &page, selectMembershipsQuery, after.UserID, after.EventID, DefaultBatchSize)
+			}},
+			{TypeOccurrence, func(after Record) ([]Record, error) {
+				recurrenceID := after.RecurrenceID
+				if recurrenceID == "" {
+					recurrenceID = time.Time{}.Format(time.RFC3339)
+				}
+
+				page := make([]Record, 0, DefaultBatchSize)
+
+				return page, sqlxutils.Select(ctx, tx, &page, selectOccurrencesQuery, after.EventID, recurrenceID, DefaultBatchSize)
+			}},
+		}
+
+		for _, table := range tables {
+			count, err := exportTable(w, table.recordType, table.selectPage)
+			if err != nil {
+				return fmt.Errorf("export %s records: %w", table.recordType, err)
+			}
+
+			stats[table.recordType] = count
+		}
+
+		return w.Flush()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+type ImportOptions struct {
+	// BatchSize is the number of records imported in one transaction.
+	BatchSize int
+	// Skip is the number of leading records to skip, e.g. the ones imported before an interruption.
+	Skip uint64
+	// DryRun only reads and validates the records.
+	DryRun bool
+}
+
+var insertQueries = map[RecordType]string{
+	TypeUser:       insertUserQuery,
+	TypeEvent:      insertEventQuery,
+	TypeMembership: insertMembershipQuery,
+	TypeOccurrence: insertOccurrenceQuery,
+}
+
+// importBatch inserts records in one transaction and returns the number of inserted records by type;
+// records of existing rows are skipped.
+func importBatch(ctx context.Context, db *sqlxutils.DB, batch []Record) (Stats, error) {
+	inserted := make(Stats)
+
+	err := sqlxutils.RunTx(ctx, db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		for _, record := range batch {
+			res, err := sqlxutils.NamedExec(ctx, tx, insertQueries[record.Type], record)
+			if err != nil {
+				return err
+			}
+
+			rowsCount, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+
+			inserted[record.Type] += uint64(rowsCount)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return inserted, nil
+}
+
+// ResetSequences moves the id sequences past the ids inserted explicitly. SQLite does it on insert.
+func ResetSequences(ctx context.Context, db *sqlxutils.DB) error {
+	if db.DriverName() != "postgres" {
+		return nil
+	}
+
+	for _, query := range []string{resetUsersSequenceQuery, resetEventsSequenceQuery} {
+		_, err := sqlxutils.Exec(ctx, db, query)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Import reads records from r and inserts them in batches, each in its own transaction, keeping their ids.
+// Records of rows that already exist are skipped, so an interrupted import can be repeated or resumed
+// with ImportOptions.Skip set to the number of records reported as committed. It returns the number of
+// inserted records by type, or of valid records in a dry run.
+func Import(ctx context.Context, db *sqlxutils.DB, r Reader, options ImportOptions, logger *slog.Logger) (Stats, error) {
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultBatchSize
+	}
+
+	stats := make(Stats)
+	batch := make([]Record, 0, options.BatchSize)
+
+	// read is the number of records read so far, committed is the number of the leading ones
+	// that are imported or skipped.
+	var read, committed uint64
+
+	flush := func() error {
+		inserted, err := importBatch(ctx, db, batch)
+		if err != nil {
+			return fmt.Errorf("import records %d-%d: %w; %d records are committed, resume with skip %d",
+				committed+1, read, err, committed, committed)
+		}
+
+		for recordType, count := range inserted {
+			stats[recordType] += count
+		}
+
+		committed = read
+		batch = batch[:0]
+
+		logger.Debug(fmt.Sprintf("committed %d records", committed))
+
+		return nil
+	}
+
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return stats, fmt.Errorf("read record %d: %w", read+1, err)
+		}
+
+		read++
+
+		if read <= options.Skip {
+			committed = read
+			continue
+		}
+
+		err = record.validate()
+		if err != nil {
+			return stats, fmt.Errorf("record %d: %w", read, err)
+		}
+
+		if options.DryRun {
+			stats[record.Type]++
+			continue
+		}
+
+		batch = append(batch, record)
+
+		if len(batch) == options.BatchSize {
+			err = flush()
+			if err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	if options.DryRun {
+		return stats, nil
+	}
+
+	if len(batch) != 0 {
+		err := flush()
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, ResetSequences(ctx, db)
+}
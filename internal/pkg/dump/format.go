@@ -0,0 +1,235 @@
+package dump
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+type Format string
+
+const (
+	// FormatJSONL writes a JSON object per line.
+	FormatJSONL Format = "jsonl"
+	// FormatCSV writes a row per record with the columns of all record types after a header.
+	FormatCSV Format = "csv"
+)
+
+func ParseFormat(value string) (Format, error) {
+	switch Format(value) {
+	case FormatJSONL, FormatCSV:
+		return Format(value), nil
+	default:
+		return "", fmt.Errorf("unsupported format %q, expected %q or %q", value, FormatJSONL, FormatCSV)
+	}
+}
+
+type Writer interface {
+	Write(record Record) error
+	// Flush writes buffered records.
+	Flush() error
+}
+
+// Reader returns io.EOF after the last record.
+type Reader interface {
+	Read() (Record, error)
+}
+
+func NewWriter(w io.Writer, format Format) Writer {
+	if format == FormatCSV {
+		return &csvWriter{w: csv.NewWriter(w)}
+	}
+
+	buffered := bufio.NewWriter(w)
+
+	return &jsonlWriter{w: buffered, encoder: json.NewEncoder(buffered)}
+}
+
+func NewReader(r io.Reader, format Format) Reader {
+	if format == FormatCSV {
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = len(csvHeader)
+
+		return &csvReader{r: reader}
+	}
+
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	return &jsonlReader{decoder: decoder}
+}
+
+type jsonlWriter struct {
+	w       *bufio.Writer
+	encoder *json.Encoder
+}
+
+func (w *jsonlWriter) Write(record Record) error {
+	return w.encoder.Encode(record)
+}
+
+func (w *jsonlWriter) Flush() error {
+	return w.w.Flush()
+}
+
+type jsonlReader struct {
+	decoder *json.Decoder
+}
+
+func (r *jsonlReader) Read() (Record, error) {
+	var record Record
+
+	err := r.decoder.Decode(&record)
+	if err != nil {
+		return Record{}, err
+	}
+
+	return record, nil
+}
+
+var csvHeader = []string{
+	"type", "id", "name", "timestamp", "rrule", "time_zone", "exdates", "deleted_at", "version",
+	"user_id", "event_id", "recurrence_id",
+}
+
+func formatUint(value uint64) string {
+	if value == 0 {
+		return ""
+	}
+
+	return strconv.FormatUint(value, 10)
+}
+
+func parseUint(value string) (uint64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	return strconv.ParseUint(value, 10, 64)
+}
+
+func formatOptional(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
+
+func parseOptional(value string) *string {
+	if value == "" {
+		return nil
+	}
+
+	return &value
+}
+
+type csvWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func (w *csvWriter) Write(record Record) error {
+	if !w.headerWritten {
+		err := w.w.Write(csvHeader)
+		if err != nil {
+			return err
+		}
+
+		w.headerWritten = true
+	}
+
+	var deletedAt string
+	if record.DeletedAt != nil {
+		deletedAt = record.DeletedAt.UTC().Format(time.RFC3339)
+	}
+
+	return w.w.Write([]string{
+		string(record.Type),
+		formatUint(record.ID),
+		record.Name,
+		record.Timestamp,
+		formatOptional(record.RRule),
+		formatOptional(record.TimeZone),
+		formatOptional(record.ExDates),
+		deletedAt,
+		formatUint(record.Version),
+		formatUint(record.UserID),
+		formatUint(record.EventID),
+		record.RecurrenceID,
+	})
+}
+
+func (w *csvWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type csvReader struct {
+	r          *csv.Reader
+	headerRead bool
+}
+
+func (r *csvReader) Read() (Record, error) {
+	if !r.headerRead {
+		header, err := r.r.Read()
+		if err != nil {
+			return Record{}, err
+		}
+
+		for i, column := range csvHeader {
+			if header[i] != column {
+				return Record{}, fmt.Errorf("unexpected csv header, expected %v", csvHeader)
+			}
+		}
+
+		r.headerRead = true
+	}
+
+	row, err := r.r.Read()
+	if err != nil {
+		return Record{}, err
+	}
+
+	record := Record{
+		Type:         RecordType(row[0]),
+		Name:         row[2],
+		Timestamp:    row[3],
+		RRule:        parseOptional(row[4]),
+		TimeZone:     parseOptional(row[5]),
+		ExDates:      parseOptional(row[6]),
+		RecurrenceID: row[11],
+	}
+
+	if row[7] != "" {
+		deletedAt, err := time.Parse(time.RFC3339, row[7])
+		if err != nil {
+			return Record{}, fmt.Errorf("invalid deleted_at: %w", err)
+		}
+
+		record.DeletedAt = &deletedAt
+	}
+
+	record.ID, err = parseUint(row[1])
+	if err == nil {
+		record.Version, err = parseUint(row[8])
+	}
+
+	if err == nil {
+		record.UserID, err = parseUint(row[9])
+	}
+
+	if err == nil {
+		record.EventID, err = parseUint(row[10])
+	}
+
+	if err != nil {
+		return Record{}, fmt.Errorf("invalid number: %w", err)
+	}
+
+	return record, nil
+}
@@ -0,0 +1,69 @@
+package dump
+
+// Tables are exported in pages ordered by their keys; the arguments are the key of the last exported row
+// and the page size.
+const (
+	selectUsersQuery = `
+        /* dump_select_users */
+        select id, name, deleted_at, version from users where id > $1 order by id limit $2;
+    `
+	selectEventsQuery = `
+        /* dump_select_events */
+        select id, name, timestamp, rrule, time_zone, exdates, deleted_at, version
+        from events
+        where id > $1
+        order by id
+        limit $2;
+    `
+	selectMembershipsQuery = `
+        /* dump_select_memberships */
+        select user_id, event_id
+        from users_and_events
+        where (user_id, event_id) > ($1, $2)
+        order by user_id, event_id
+        limit $3;
+    `
+	selectOccurrencesQuery = `
+        /* dump_select_occurrences */
+        select event_id, recurrence_id, name, timestamp
+        from event_occurrences
+        where (event_id, recurrence_id) > ($1, $2)
+        order by event_id, recurrence_id
+        limit $3;
+    `
+)
+
+// Imported rows keep their ids; rows that already exist are skipped, so an import can be repeated.
+const (
+	insertUserQuery = `
+        /* dump_insert_user */
+        insert into users(id, name, deleted_at, version) values (:id, :name, :deleted_at, :version)
+        on conflict do nothing;
+    `
+	insertEventQuery = `
+        /* dump_insert_event */
+        insert into events(id, name, timestamp, rrule, time_zone, exdates, deleted_at, version)
+        values (:id, :name, :timestamp, :rrule, :time_zone, :exdates, :deleted_at, :version)
+        on conflict do nothing;
+    `
+	insertMembershipQuery = `
+        /* dump_insert_membership */
+        insert into users_and_events(user_id, event_id) values (:user_id, :event_id)
+        on conflict do nothing;
+    `
+	insertOccurrenceQuery = `
+        /* dump_insert_occurrence */
+        insert into event_occurrences(event_id, recurrence_id, name, timestamp)
+        values (:event_id, :recurrence_id, :name, :timestamp)
+        on conflict do nothing;
+    `
+	// Identity sequences of PostgreSQL don't advance on inserts with explicit ids.
+	resetUsersSequenceQuery = `
+        /* dump_reset_users_sequence */
+        select setval(pg_get_serial_sequence('users', 'id'), coalesce(max(id), 1), max(id) is not null) from users;
+    `
+	resetEventsSequenceQuery = `
+        /* dump_reset_events_sequence */
+        select setval(pg_get_serial_sequence('events', 'id'), coalesce(max(id), 1), max(id) is not null) from events;
+    `
+)
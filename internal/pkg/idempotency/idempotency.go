@@ -0,0 +1,169 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Inspirate789/grpc-template/internal/models"
+	"github.com/Inspirate789/grpc-template/internal/pkg/auth"
+	"github.com/Inspirate789/grpc-template/pkg/sqlxutils"
+)
+
+// Header is the gRPC metadata key and the HTTP header carrying the idempotency key of a request.
+const Header = "idempotency-key"
+
+// MaxKeyLength bounds keys; clients usually send UUIDs.
+const MaxKeyLength = 255
+
+const defaultTTL = 24 * time.Hour
+
+type Config struct {
+	// TTL is how long a key is remembered; retries after it create a new resource.
+	TTL time.Duration
+}
+
+type keyKey struct{}
+
+func WithKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, keyKey{}, key)
+}
+
+// KeyFromContext returns the idempotency key sent by the client, if any.
+func KeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(keyKey{}).(string)
+	return key, ok && key != ""
+}
+
+// ValidateKey reports keys that are too long to be stored.
+func ValidateKey(key string) error {
+	if len(key) > MaxKeyLength {
+		return models.NewInvalidArgumentError(models.FieldViolation{
+			Field:       Header,
+			Description: "value length must be at most " + strconv.Itoa(MaxKeyLength) + " characters",
+		})
+	}
+
+	return nil
+}
+
+// Store remembers the resources created by requests with idempotency keys.
+type Store struct {
+	db  *sqlxutils.DB
+	ttl time.Duration
+}
+
+func NewStore(db *sqlxutils.DB, config Config) *Store {
+	if config.TTL <= 0 {
+		config.TTL = defaultTTL
+	}
+
+	return &Store{
+		db:  db,
+		ttl: config.TTL,
+	}
+}
+
+type keyDTO struct {
+	RequestHash string `db:"request_hash"`
+	ResourceID  uint64 `db:"resource_id"`
+}
+
+func requestHash(payload any) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(data)
+
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// scope separates the keys of different resources and principals.
+func scope(ctx context.Context, resource string) string {
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok {
+		return resource
+	}
+
+	return resource + "/" + principal.Subject
+}
+
+// Create runs create in tx unless the idempotency key of the request has already been used.
+// A repeated key returns the id of the resource created with it if payload is the same,
+// otherwise it fails with AlreadyExists. Requests without a key always run create.
+// created reports whether create ran, so a replayed request isn't mistaken for a new resource.
+func (s *Store) Create(
+	ctx context.Context,
+	tx *sqlxutils.Tx,
+	resource string,
+	payload any,
+	create func() (uint64, error),
+) (id uint64, created bool, err error) {
+	key, ok := KeyFromContext(ctx)
+	if !ok {
+		id, err = create()
+		return id, err == nil, err
+	}
+
+	hash, err := requestHash(payload)
+	if err != nil {
+		return 0, false, err
+	}
+
+	keyScope := scope(ctx, resource)
+	now := sqlxutils.Now()
+
+	var dto keyDTO
+
+	err = sqlxutils.Get(ctx, tx, &dto, selectKeyQuery, keyScope, key, now)
+	if err == nil {
+		if dto.RequestHash != hash {
+			return 0, false, &models.AlreadyExistsError{Resource: "idempotency key", Name: key}
+		}
+
+		return dto.ResourceID, false, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, err
+	}
+
+	id, err = create()
+	if err != nil {
+		return 0, false, err
+	}
+
+	res, err := sqlxutils.Exec(ctx, tx, insertKeyQuery, keyScope, key, hash, id, now.Add(s.ttl), now)
+	if err != nil {
+		return 0, false, err
+	}
+
+	rowsCount, err := res.RowsAffected()
+	if err != nil {
+		return 0, false, err
+	} else if rowsCount == 0 {
+		return 0, false, &models.ConflictError{
+			Resource:    "idempotency key",
+			Name:        key,
+			Description: "a request with the same key is in progress, retry the request",
+		}
+	}
+
+	return id, true, nil
+}
+
+// PurgeDeleted deletes expired keys, so the purger removes them along with soft-deleted rows.
+// Keys expire by the TTL, so before is ignored.
+func (s *Store) PurgeDeleted(ctx context.Context, _ time.Time) (int64, error) {
+	res, err := sqlxutils.Exec(ctx, s.db, purgeKeysQuery, sqlxutils.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
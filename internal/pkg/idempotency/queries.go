@@ -0,0 +1,21 @@
+package idempotency
+
+// Expired keys are ignored by lookups and replaced by new requests with the same key.
+const (
+	selectKeyQuery = `
+        /* select_idempotency_key */
+        select request_hash, resource_id
+        from idempotency_keys
+        where scope = $1 and idempotency_key = $2 and expires_at > $3;
+    `
+	// insertKeyQuery inserts nothing if an unexpired key was saved by a concurrent request.
+	insertKeyQuery = `
+        /* insert_idempotency_key */
+        insert into idempotency_keys(scope, idempotency_key, request_hash, resource_id, expires_at)
+        values ($1, $2, $3, $4, $5)
+        on conflict (scope, idempotency_key) do update
+        set request_hash = excluded.request_hash, resource_id = excluded.resource_id, expires_at = excluded.expires_at
+        where idempotency_keys.expires_at <= $6;
+    `
+	purgeKeysQuery = `/* purge_idempotency_keys */ delete from idempotency_keys where expires_at <= $1;`
+)
@@ -0,0 +1,143 @@
+package seed
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/Inspirate789/grpc-template/internal/pkg/dump"
+)
+
+// eventsPeriod is the period event timestamps are spread over, starting at Options.Start.
+const eventsPeriod = 365 * 24 * time.Hour
+
+type Options struct {
+	Users  uint64
+	Events uint64
+	// Density is the expected share of users participating in each event, from 0 to 1.
+	Density float64
+	// Seed makes the generator produce the same dataset every time.
+	Seed uint64
+	// Start is the earliest timestamp of the generated events; a fixed one keeps them the same for a seed.
+	Start time.Time
+}
+
+func (o Options) validate() error {
+	if o.Users == 0 && o.Events == 0 {
+		return errors.New("nothing to generate: set the number of users or events")
+	} else if o.Density < 0 || o.Density > 1 {
+		return errors.New("density must be between 0 and 1")
+	} else if o.Start.IsZero() {
+		return errors.New("start of the event timestamps must be set")
+	}
+
+	return nil
+}
+
+// generator produces users, events and memberships as dump records, with ids after the last existing ones.
+type generator struct {
+	options Options
+	// random is seeded, so that a seed reproduces a dataset.
+	random      *rand.ChaCha8
+	lastUserID  uint64
+	lastEventID uint64
+	start       time.Time
+
+	users  uint64
+	events uint64
+	// membershipEvents is the number of events whose participants are generated.
+	membershipEvents uint64
+	participants     []uint64
+	// participantsCarry is the fraction of the expected participants left after rounding down,
+	// carried to the next event.
+	participantsCarry float64
+}
+
+func newGenerator(options Options, lastUserID, lastEventID uint64) *generator {
+	var seed [32]byte
+	binary.LittleEndian.PutUint64(seed[:], options.Seed)
+
+	return &generator{
+		options:     options,
+		random:      rand.NewChaCha8(seed),
+		lastUserID:  lastUserID,
+		lastEventID: lastEventID,
+		start:       options.Start.UTC(),
+	}
+}
+
+// uintN returns a number in [0, n).
+func (g *generator) uintN(n uint64) uint64 {
+	return g.random.Uint64() % n
+}
+
+// sampleParticipants picks distinct users for an event: on average Density of all of them.
+// It uses Floyd's algorithm, so it takes as many steps as the users picked.
+func (g *generator) sampleParticipants() []uint64 {
+	g.participantsCarry += float64(g.options.Users) * g.options.Density
+	count := uint64(g.participantsCarry)
+	g.participantsCarry -= float64(count)
+
+	picked := make(map[uint64]struct{}, count)
+	participants := make([]uint64, 0, count)
+
+	for i := g.options.Users - count; i < g.options.Users; i++ {
+		user := g.uintN(i + 1)
+		if _, ok := picked[user]; ok {
+			user = i
+		}
+
+		picked[user] = struct{}{}
+		participants = append(participants, g.lastUserID+user+1)
+	}
+
+	return participants
+}
+
+func (g *generator) Read() (dump.Record, error) {
+	switch {
+	case g.users < g.options.Users:
+		g.users++
+		id := g.lastUserID + g.users
+
+		return dump.Record{
+			Type:    dump.TypeUser,
+			ID:      id,
+			Name:    "user" + strconv.FormatUint(id, 10),
+			Version: 1,
+		}, nil
+	case g.events < g.options.Events:
+		g.events++
+		id := g.lastEventID + g.events
+		timestamp := g.start.Add(time.Duration(g.uintN(uint64(eventsPeriod/time.Minute))) * time.Minute)
+
+		return dump.Record{
+			Type:      dump.TypeEvent,
+			ID:        id,
+			Name:      "event" + strconv.FormatUint(id, 10),
+			Timestamp: timestamp.UTC().Format(time.RFC3339),
+			Version:   1,
+		}, nil
+	}
+
+	for len(g.participants) == 0 {
+		if g.membershipEvents == g.options.Events {
+			return dump.Record{}, io.EOF
+		}
+
+		g.membershipEvents++
+		g.participants = g.sampleParticipants()
+	}
+
+	userID := g.participants[0]
+	g.participants = g.participants[1:]
+
+	return dump.Record{
+		Type:    dump.TypeMembership,
+		UserID:  userID,
+		EventID: g.lastEventID + g.membershipEvents,
+	}, nil
+}
@@ -0,0 +1,85 @@
+// Package seed fills a database with test data: SQL fixtures or a generated dataset of any size.
+package seed
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+
+	"github.com/Inspirate789/grpc-template/internal/pkg/dump"
+	"github.com/Inspirate789/grpc-template/pkg/sqlxutils"
+)
+
+const (
+	selectMaxUserIDQuery = `
+        /* seed_select_max_user_id */
+        select coalesce(max(id), 0) from users;
+    `
+	selectMaxEventIDQuery = `
+        /* seed_select_max_event_id */
+        select coalesce(max(id), 0) from events;
+    `
+)
+
+// LoadFixtures runs the *.sql files of fixtures in the order of their names, each in its own transaction.
+// The statements must run on all drivers, and should skip existing rows to load into an existing database.
+// It returns the names of the loaded files.
+func LoadFixtures(ctx context.Context, db *sqlxutils.DB, fixtures fs.FS) ([]string, error) {
+	names, err := fs.Glob(fixtures, "*.sql")
+	if err != nil {
+		return nil, err
+	} else if len(names) == 0 {
+		return nil, errors.New("no *.sql fixtures found")
+	}
+
+	for _, name := range names {
+		content, readErr := fs.ReadFile(fixtures, name)
+		if readErr != nil {
+			return nil, readErr
+		}
+
+		err = sqlxutils.RunTx(ctx, db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+			_, err := sqlxutils.Exec(ctx, tx, string(content))
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("load %s: %w", name, err)
+		}
+	}
+
+	return names, dump.ResetSequences(ctx, db)
+}
+
+// Generate inserts a dataset made by a generator with the options after the existing users and events.
+// It returns the number of inserted records by type.
+func Generate(
+	ctx context.Context,
+	db *sqlxutils.DB,
+	options Options,
+	batchSize int,
+	logger *slog.Logger,
+) (dump.Stats, error) {
+	err := options.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	var lastUserID, lastEventID uint64
+
+	err = sqlxutils.Get(ctx, db, &lastUserID, selectMaxUserIDQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqlxutils.Get(ctx, db, &lastEventID, selectMaxEventIDQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	generator := newGenerator(options, lastUserID, lastEventID)
+
+	return dump.Import(ctx, db, generator, dump.ImportOptions{BatchSize: batchSize}, logger)
+}
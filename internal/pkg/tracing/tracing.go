@@ -0,0 +1,130 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/multierr"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+type Config struct {
+	ServiceName string
+	// Exporter is one of "none", "otlp", "stdout" and "file". Without an exporter spans are
+	// still created, so trace ids show up in the logs.
+	Exporter string
+	// Endpoint is the OTLP gRPC collector address, e.g. localhost:4317.
+	Endpoint string
+	Insecure bool
+	// File receives spans as JSON lines for the "file" exporter.
+	File string
+	// SampleRatio is the share of new traces to record; sampling decisions of callers are respected.
+	SampleRatio float64
+}
+
+type Provider struct {
+	*sdktrace.TracerProvider
+	closer io.Closer
+}
+
+func newExporter(ctx context.Context, config Config) (sdktrace.SpanExporter, io.Closer, error) {
+	switch config.Exporter {
+	case ExporterOTLP:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(config.Endpoint)}
+		if config.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+
+		exporter, err := otlptracegrpc.New(ctx, opts...)
+
+		return exporter, nil, errors.Wrap(err, "create otlp exporter")
+	case ExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+
+		return exporter, nil, errors.Wrap(err, "create stdout exporter")
+	case ExporterFile:
+		file, err := os.OpenFile(config.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "open traces file")
+		}
+
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			return nil, nil, multierr.Combine(errors.Wrap(err, "create file exporter"), file.Close())
+		}
+
+		return exporter, file, nil
+	case ExporterNone, "":
+		return nil, nil, nil
+	default:
+		return nil, nil, errors.Errorf("unknown trace exporter %q", config.Exporter)
+	}
+}
+
+// New creates a tracer provider and installs it, along with the W3C trace context and baggage
+// propagators, as the global one used by the instrumentation.
+func New(ctx context.Context, config Config) (*Provider, error) {
+	exporter, closer, err := newExporter(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(config.ServiceName)))
+	if err != nil {
+		return nil, errors.Wrap(err, "create trace resource")
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	}
+	if exporter != nil {
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+
+	provider := sdktrace.NewTracerProvider(opts...)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return &Provider{TracerProvider: provider, closer: closer}, nil
+}
+
+// Shutdown flushes the remaining spans and releases the exporter.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	err := p.TracerProvider.Shutdown(ctx)
+	if p.closer != nil {
+		err = multierr.Append(err, p.closer.Close())
+	}
+
+	return errors.Wrap(err, "shutdown tracer provider")
+}
+
+// End records err on the span, if any, and ends it. Call it deferred with the named error result:
+//
+//	defer func() { tracing.End(span, err) }()
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
@@ -0,0 +1,43 @@
+package validation
+
+import (
+	"errors"
+
+	"github.com/Inspirate789/grpc-template/internal/models"
+	"github.com/bufbuild/protovalidate-go"
+	"google.golang.org/protobuf/proto"
+)
+
+type Validator struct {
+	validator protovalidate.Validator
+}
+
+func New() (*Validator, error) {
+	validator, err := protovalidate.New()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Validator{validator: validator}, nil
+}
+
+// Validate checks the message against the buf.validate rules declared in its proto definition
+// and reports broken rules as a models.InvalidArgumentError with one violation per field.
+func (v *Validator) Validate(msg proto.Message) error {
+	err := v.validator.Validate(msg)
+
+	var validationErr *protovalidate.ValidationError
+	if !errors.As(err, &validationErr) {
+		return err
+	}
+
+	violations := make([]models.FieldViolation, 0, len(validationErr.Violations))
+	for _, violation := range validationErr.Violations {
+		violations = append(violations, models.FieldViolation{
+			Field:       protovalidate.FieldPathString(violation.Proto.GetField()),
+			Description: violation.Proto.GetMessage(),
+		})
+	}
+
+	return models.NewInvalidArgumentError(violations...)
+}
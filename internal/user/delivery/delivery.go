@@ -3,41 +3,84 @@ package delivery
 import (
 	"context"
 	"log/slog"
-	"math"
 
 	"github.com/Inspirate789/grpc-template/internal/models"
+	"github.com/Inspirate789/grpc-template/internal/pkg/app"
 	grpc "google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type UseCase interface {
 	HealthCheck(ctx context.Context) error
 	CreateUser(ctx context.Context, name string) (id uint64, err error)
-	UpdateUser(ctx context.Context, user models.User) (found bool, err error)
-	DeleteUser(ctx context.Context, id uint64) error
-	GetUser(ctx context.Context, id uint64) (user models.User, found bool, err error)
-	GetUsers(ctx context.Context, limit, offset uint64) ([]models.User, uint64, error)
-	GetUsersByEvent(ctx context.Context, eventID, limit, offset uint64) ([]models.User, uint64, error)
+	UpdateUser(ctx context.Context, user models.User) (models.User, error)
+	DeleteUser(ctx context.Context, id, version uint64) error
+	GetUser(ctx context.Context, id uint64, showDeleted bool) (models.User, error)
+	GetUsers(ctx context.Context, page models.Page) ([]models.User, uint64, error)
+	GetUsersByEvent(ctx context.Context, eventID uint64, page models.Page) ([]models.User, uint64, error)
+	BatchCreateUsers(ctx context.Context, names []string, mode models.BatchMode) ([]models.BatchResult, error)
+	BatchGetUsers(ctx context.Context, ids []uint64, showDeleted bool) (users []models.User, missing []uint64, err error)
+	RestoreUser(ctx context.Context, id uint64) (models.User, error)
+}
+
+type Validator interface {
+	Validate(msg proto.Message) error
 }
 
 type Delivery struct {
-	useCase UseCase
-	logger  *slog.Logger
+	useCase   UseCase
+	validator Validator
+	logger    *slog.Logger
 	UnimplementedUserServiceServer
 }
 
-func New(useCase UseCase, logger *slog.Logger) *Delivery {
+func New(useCase UseCase, validator Validator, logger *slog.Logger) *Delivery {
 	return &Delivery{
-		useCase: useCase,
-		logger:  logger,
+		useCase:   useCase,
+		validator: validator,
+		logger:    logger,
+	}
+}
+
+func newUserDTO(user models.User) *User {
+	dto := &User{
+		Id:      user.ID,
+		Name:    user.Name,
+		Version: user.Version,
+	}
+
+	if user.DeletedAt != nil {
+		dto.DeletedAt = timestamppb.New(*user.DeletedAt)
+	}
+
+	return dto
+}
+
+func newUserModel(user *User) models.User {
+	model := models.User{
+		ID:      user.GetId(),
+		Name:    user.GetName(),
+		Version: user.GetVersion(),
+	}
+
+	if user.GetDeletedAt() != nil {
+		deletedAt := user.GetDeletedAt().AsTime()
+		model.DeletedAt = &deletedAt
 	}
+
+	return model
 }
 
 func (d *Delivery) Register(server grpc.ServiceRegistrar) {
 	RegisterUserServiceServer(server, d)
 }
 
+func (d *Delivery) ServiceName() string {
+	return UserService_ServiceDesc.ServiceName
+}
+
 func (d *Delivery) HealthCheck(ctx context.Context) error {
 	return d.useCase.HealthCheck(ctx)
 }
@@ -45,7 +88,7 @@ func (d *Delivery) HealthCheck(ctx context.Context) error {
 func (d *Delivery) CreateUser(ctx context.Context, request *CreateUserRequest) (*CreateUserResponse, error) {
 	id, err := d.useCase.CreateUser(ctx, request.GetName())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, err
 	}
 
 	return &CreateUserResponse{Id: id}, nil
@@ -53,71 +96,152 @@ func (d *Delivery) CreateUser(ctx context.Context, request *CreateUserRequest) (
 
 func (d *Delivery) UpdateUser(ctx context.Context, request *UpdateUserRequest) (*UpdateUserResponse, error) {
 	user := models.User{
-		ID:   request.GetUser().GetId(),
-		Name: request.GetUser().GetName(),
+		ID:      request.GetUser().GetId(),
+		Name:    request.GetUser().GetName(),
+		Version: request.GetUser().GetVersion(),
 	}
 
-	found, err := d.useCase.UpdateUser(ctx, user)
+	user, err := d.useCase.UpdateUser(ctx, user)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
-	} else if !found {
-		return nil, status.Error(codes.NotFound, "user not found")
+		return nil, err
 	}
 
-	return &UpdateUserResponse{}, nil
+	return &UpdateUserResponse{User: newUserDTO(user)}, nil
 }
 
 func (d *Delivery) DeleteUser(ctx context.Context, request *DeleteUserRequest) (*DeleteUserResponse, error) {
-	return &DeleteUserResponse{}, d.useCase.DeleteUser(ctx, request.GetId())
+	err := d.useCase.DeleteUser(ctx, request.GetId(), request.GetVersion())
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeleteUserResponse{}, nil
+}
+
+func (d *Delivery) RestoreUser(ctx context.Context, request *RestoreUserRequest) (*RestoreUserResponse, error) {
+	user, err := d.useCase.RestoreUser(ctx, request.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	return &RestoreUserResponse{User: newUserDTO(user)}, nil
 }
 
 func (d *Delivery) GetUser(ctx context.Context, request *GetUserRequest) (*GetUserResponse, error) {
-	user, found, err := d.useCase.GetUser(ctx, request.GetId())
+	user, err := d.useCase.GetUser(ctx, request.GetId(), request.GetShowDeleted())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
-	} else if !found {
-		return nil, status.Error(codes.NotFound, "user not found")
+		return nil, err
 	}
 
-	return &GetUserResponse{
-		User: &User{
-			Id:   user.ID,
-			Name: user.Name,
-		},
-	}, nil
+	return &GetUserResponse{User: newUserDTO(user)}, nil
 }
 
 func (d *Delivery) GetUsers(ctx context.Context, request *ListUsersRequest) (*ListUsersResponse, error) {
-	eventID := request.GetEventId()
-	offset := request.GetOffset()
 	limit := request.GetLimit()
 	if limit == 0 {
-		limit = math.MaxInt32
+		limit = models.DefaultPageLimit
 	}
 
+	query := models.NewPageQuery("id", request.EventId, request.GetShowDeleted())
+
+	page, err := models.NewPage(limit+1, request.GetOffset(), request.GetPageToken(), !request.GetSkipTotalCount(), query)
+	if err != nil {
+		return nil, err
+	}
+
+	page.ShowDeleted = request.GetShowDeleted()
+
 	var (
 		users      []models.User
 		totalCount uint64
-		err        error
 	)
 
 	if request.EventId != nil {
-		users, totalCount, err = d.useCase.GetUsersByEvent(ctx, eventID, limit, offset)
+		users, totalCount, err = d.useCase.GetUsersByEvent(ctx, request.GetEventId(), page)
 	} else {
-		users, totalCount, err = d.useCase.GetUsers(ctx, limit, offset)
+		users, totalCount, err = d.useCase.GetUsers(ctx, page)
 	}
 
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, err
+	}
+
+	res := &ListUsersResponse{}
+
+	if uint64(len(users)) > limit {
+		users = users[:limit]
+		res.NextPageToken = models.Cursor{ID: users[len(users)-1].ID, PageQuery: query}.Token()
+	}
+
+	if page.WithTotalCount {
+		res.TotalCount = &totalCount
 	}
 
-	dto := make([]*User, 0, len(users))
+	res.Users = make([]*User, 0, len(users))
 	for _, user := range users {
-		dto = append(dto, &User{
-			Id:   user.ID,
-			Name: user.Name,
+		res.Users = append(res.Users, newUserDTO(user))
+	}
+
+	return res, nil
+}
+
+func newBatchMode(mode BatchMode) models.BatchMode {
+	if mode == BatchMode_BATCH_MODE_BEST_EFFORT {
+		return models.BatchBestEffort
+	}
+
+	return models.BatchAtomic
+}
+
+func (d *Delivery) newBatchItemStatus(ctx context.Context, err error) *BatchItemStatus {
+	st := app.ErrorStatus(err)
+	if st.Code() == codes.Internal {
+		d.logger.ErrorContext(ctx, err.Error())
+	}
+
+	return &BatchItemStatus{
+		Code:    uint32(st.Code()),
+		Message: st.Message(),
+	}
+}
+
+func (d *Delivery) BatchCreateUsers(ctx context.Context, request *BatchCreateUsersRequest) (*BatchCreateUsersResponse, error) {
+	names := make([]string, 0, len(request.GetUsers()))
+	for _, user := range request.GetUsers() {
+		names = append(names, user.GetName())
+	}
+
+	results, err := d.useCase.BatchCreateUsers(ctx, names, newBatchMode(request.GetMode()))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &BatchCreateUsersResponse{
+		Results: make([]*BatchCreateUsersResponse_Result, 0, len(results)),
+	}
+	for _, result := range results {
+		res.Results = append(res.Results, &BatchCreateUsersResponse_Result{
+			Id:     result.ID,
+			Status: d.newBatchItemStatus(ctx, result.Err),
 		})
 	}
 
-	return &ListUsersResponse{Users: dto, TotalCount: totalCount}, nil
+	return res, nil
+}
+
+func (d *Delivery) BatchGetUsers(ctx context.Context, request *BatchGetUsersRequest) (*BatchGetUsersResponse, error) {
+	users, missing, err := d.useCase.BatchGetUsers(ctx, request.GetIds(), request.GetShowDeleted())
+	if err != nil {
+		return nil, err
+	}
+
+	res := &BatchGetUsersResponse{
+		Users:      make([]*User, 0, len(users)),
+		MissingIds: missing,
+	}
+	for _, user := range users {
+		res.Users = append(res.Users, newUserDTO(user))
+	}
+
+	return res, nil
 }
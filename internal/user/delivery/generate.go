@@ -1,3 +1,4 @@
 package delivery
 
-//go:generate protoc --go_opt=paths=source_relative --go_out=. --go-grpc_opt=paths=source_relative --go-grpc_out=. -I../api user.proto
+//go:generate buf export buf.build/bufbuild/protovalidate --output ../../../third_party
+//go:generate protoc --go_opt=paths=source_relative --go_out=. --go-grpc_opt=paths=source_relative --go-grpc_out=. -I../api -I../../../third_party user.proto
@@ -0,0 +1,240 @@
+package delivery
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Inspirate789/grpc-template/internal/models"
+	"github.com/Inspirate789/grpc-template/internal/pkg/app"
+	"github.com/gofiber/fiber/v2"
+)
+
+type userJSON struct {
+	ID        uint64     `json:"id"`
+	Name      string     `json:"name"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	Version   uint64     `json:"version"`
+}
+
+type usersJSON struct {
+	Users         []userJSON `json:"users"`
+	TotalCount    *uint64    `json:"total_count,omitempty"`
+	NextPageToken string     `json:"next_page_token,omitempty"`
+}
+
+type createUserJSON struct {
+	Name string `json:"name"`
+}
+
+type listUsersQuery struct {
+	Limit          *uint64 `query:"limit"`
+	Offset         *uint64 `query:"offset"`
+	EventID        *uint64 `query:"event_id"`
+	PageToken      string  `query:"page_token"`
+	SkipTotalCount bool    `query:"skip_total_count"`
+	ShowDeleted    bool    `query:"show_deleted"`
+}
+
+type getUserQuery struct {
+	ShowDeleted bool `query:"show_deleted"`
+}
+
+type idJSON struct {
+	ID uint64 `json:"id"`
+}
+
+func newUserJSON(user models.User) userJSON {
+	return userJSON{
+		ID:        user.ID,
+		Name:      user.Name,
+		DeletedAt: user.DeletedAt,
+		Version:   user.Version,
+	}
+}
+
+func parseID(ctx *fiber.Ctx) (uint64, error) {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 64)
+	if err != nil {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "invalid user id")
+	}
+
+	return id, nil
+}
+
+func (d *Delivery) AddHandlers(router fiber.Router) {
+	users := router.Group("/users")
+	users.Post("/", d.createUserHandler)
+	users.Get("/", d.getUsersHandler)
+	users.Get("/:id", d.getUserHandler)
+	users.Put("/:id", d.updateUserHandler)
+	users.Delete("/:id", d.deleteUserHandler)
+	users.Post("/:id/restore", d.restoreUserHandler)
+}
+
+func (d *Delivery) createUserHandler(ctx *fiber.Ctx) error {
+	var body createUserJSON
+
+	err := ctx.BodyParser(&body)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	request := &CreateUserRequest{Name: body.Name}
+
+	err = d.validator.Validate(request)
+	if err != nil {
+		return err
+	}
+
+	id, err := d.useCase.CreateUser(ctx.UserContext(), request.GetName())
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(idJSON{ID: id})
+}
+
+func (d *Delivery) updateUserHandler(ctx *fiber.Ctx) error {
+	id, err := parseID(ctx)
+	if err != nil {
+		return err
+	}
+
+	version, err := app.IfMatch(ctx)
+	if err != nil {
+		return err
+	}
+
+	var body createUserJSON
+
+	err = ctx.BodyParser(&body)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	err = d.validator.Validate(&UpdateUserRequest{User: &User{Id: id, Name: body.Name, Version: version}})
+	if err != nil {
+		return err
+	}
+
+	user, err := d.useCase.UpdateUser(ctx.UserContext(), models.User{ID: id, Name: body.Name, Version: version})
+	if err != nil {
+		return err
+	}
+
+	app.SetETag(ctx, user.Version)
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+func (d *Delivery) deleteUserHandler(ctx *fiber.Ctx) error {
+	id, err := parseID(ctx)
+	if err != nil {
+		return err
+	}
+
+	version, err := app.IfMatch(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = d.validator.Validate(&DeleteUserRequest{Id: id, Version: version})
+	if err != nil {
+		return err
+	}
+
+	err = d.useCase.DeleteUser(ctx.UserContext(), id, version)
+	if err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+func (d *Delivery) restoreUserHandler(ctx *fiber.Ctx) error {
+	id, err := parseID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = d.validator.Validate(&RestoreUserRequest{Id: id})
+	if err != nil {
+		return err
+	}
+
+	user, err := d.useCase.RestoreUser(ctx.UserContext(), id)
+	if err != nil {
+		return err
+	}
+
+	app.SetETag(ctx, user.Version)
+
+	return ctx.JSON(newUserJSON(user))
+}
+
+func (d *Delivery) getUserHandler(ctx *fiber.Ctx) error {
+	id, err := parseID(ctx)
+	if err != nil {
+		return err
+	}
+
+	var query getUserQuery
+
+	err = ctx.QueryParser(&query)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	err = d.validator.Validate(&GetUserRequest{Id: id, ShowDeleted: query.ShowDeleted})
+	if err != nil {
+		return err
+	}
+
+	user, err := d.useCase.GetUser(ctx.UserContext(), id, query.ShowDeleted)
+	if err != nil {
+		return err
+	}
+
+	app.SetETag(ctx, user.Version)
+
+	return ctx.JSON(newUserJSON(user))
+}
+
+func (d *Delivery) getUsersHandler(ctx *fiber.Ctx) error {
+	var query listUsersQuery
+
+	err := ctx.QueryParser(&query)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	request := &ListUsersRequest{
+		Limit:          query.Limit,
+		Offset:         query.Offset,
+		EventId:        query.EventID,
+		PageToken:      query.PageToken,
+		SkipTotalCount: query.SkipTotalCount,
+		ShowDeleted:    query.ShowDeleted,
+	}
+
+	err = d.validator.Validate(request)
+	if err != nil {
+		return err
+	}
+
+	response, err := d.GetUsers(ctx.UserContext(), request)
+	if err != nil {
+		return err
+	}
+
+	res := usersJSON{
+		Users:         make([]userJSON, 0, len(response.GetUsers())),
+		TotalCount:    response.TotalCount,
+		NextPageToken: response.GetNextPageToken(),
+	}
+	for _, user := range response.GetUsers() {
+		res.Users = append(res.Users, newUserJSON(newUserModel(user)))
+	}
+
+	return ctx.JSON(res)
+}
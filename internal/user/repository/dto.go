@@ -1,44 +1,35 @@
 package repository
 
-import "github.com/Inspirate789/grpc-template/internal/models"
+import (
+	"time"
+
+	"github.com/Inspirate789/grpc-template/internal/models"
+)
 
 type UserDTO struct {
-	ID   uint64 `db:"id"`
-	Name string `db:"name"`
+	ID        uint64     `db:"id"`
+	Name      string     `db:"name"`
+	DeletedAt *time.Time `db:"deleted_at"`
+	Version   uint64     `db:"version"`
 }
 
 func (dto UserDTO) ToModel() models.User {
 	return models.User{
-		ID:   dto.ID,
-		Name: dto.Name,
+		ID:        dto.ID,
+		Name:      dto.Name,
+		DeletedAt: dto.DeletedAt,
+		Version:   dto.Version,
 	}
 }
 
-type CountedUserDTO struct {
-	ID         uint64 `db:"id"`
-	Name       string `db:"name"`
-	TotalCount uint64 `db:"total_count"`
-}
+type UsersDTO []UserDTO
 
-func (dto CountedUserDTO) ToModel() models.User {
-	return models.User{
-		ID:   dto.ID,
-		Name: dto.Name,
-	}
-}
-
-type UsersDTO []CountedUserDTO
-
-func (dto UsersDTO) ToModel() ([]models.User, uint64) {
+func (dto UsersDTO) ToModel() []models.User {
 	res := make([]models.User, 0, len(dto))
 
 	for _, user := range dto {
 		res = append(res, user.ToModel())
 	}
 
-	if len(dto) != 0 {
-		return res, dto[0].TotalCount
-	}
-
-	return res, 0
+	return res
 }
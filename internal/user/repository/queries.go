@@ -1,15 +1,44 @@
 package repository
 
+// Soft-deleted users are hidden unless the show_deleted argument is true. Their links to events
+// are kept, so restoring a user brings its event participations back.
 const (
-	selectUserQuery         = `select * from users where id = $1 limit 1;`
-	selectUsersQuery        = `select *, count(*) over () as total_count from users limit $1 offset $2;`
+	selectUserQuery         = `/* select_user */ select * from users where id = $1 and ($2 or deleted_at is null) limit 1;`
+	selectUsersQuery        = `/* select_users */ select * from users where ($1 or deleted_at is null) and id > $2 order by id limit $3 offset $4;`
+	countUsersQuery         = `/* count_users */ select count(*) from users where $1 or deleted_at is null;`
 	selectUsersByEventQuery = `
-        select u.*, count(*) over () as total_count 
-        from users u join users_and_events ue on ue.event_id = $1 and u.id = ue.user_id
-        limit $2
-        offset $3;
-    `
-	insertUserQuery = `insert into users(name) values (:name) returning id;`
-	updateUserQuery = `update users set name = :name where id = :id;`
-	deleteUserQuery = `delete from users where id = $1;`
+        /* select_users_by_event */
+        select u.*
+        from users u
+            join users_and_events ue on ue.event_id = $1 and u.id = ue.user_id
+            join events e on e.id = ue.event_id
+        where ($2 or (u.deleted_at is null and e.deleted_at is null)) and u.id > $3
+        order by u.id
+        limit $4
+        offset $5;
+    `
+	selectUsersByIDsQuery  = `/* select_users_by_ids */ select * from users where id in (?) and (? or deleted_at is null);`
+	countUsersByEventQuery = `
+        /* count_users_by_event */
+        select count(*)
+        from users_and_events ue
+            join users u on u.id = ue.user_id
+            join events e on e.id = ue.event_id
+        where ue.event_id = $1 and ($2 or (u.deleted_at is null and e.deleted_at is null));
+    `
+	insertUserQuery = `/* insert_user */ insert into users(name) values (:name) returning id;`
+	// Updates and deletes apply to the expected version only; zero matches any version.
+	updateUserQuery = `
+        /* update_user */
+        update users set name = :name, version = version + 1
+        where id = :id and deleted_at is null and (version = :version or :version = 0)
+        returning *;
+    `
+	deleteUserQuery = `
+        /* delete_user */
+        update users set deleted_at = $1, version = version + 1
+        where id = $2 and deleted_at is null and (version = $3 or $3 = 0);
+    `
+	restoreUserQuery = `/* restore_user */ update users set deleted_at = null, version = version + 1 where id = $1 and deleted_at is not null;`
+	purgeUsersQuery  = `/* purge_users */ delete from users where deleted_at < $1;`
 )
@@ -5,20 +5,25 @@ import (
 	"database/sql"
 	"errors"
 	"log/slog"
+	"slices"
+	"time"
 
 	"github.com/Inspirate789/grpc-template/internal/models"
+	"github.com/Inspirate789/grpc-template/internal/pkg/idempotency"
 	"github.com/Inspirate789/grpc-template/pkg/sqlxutils"
 	"github.com/jmoiron/sqlx"
 )
 
 type SqlxRepository struct {
-	db     *sqlx.DB
+	db     *sqlxutils.DB
+	keys   *idempotency.Store
 	logger *slog.Logger
 }
 
-func NewSqlx(db *sqlx.DB, logger *slog.Logger) *SqlxRepository {
+func NewSqlx(db *sqlxutils.DB, keys *idempotency.Store, logger *slog.Logger) *SqlxRepository {
 	return &SqlxRepository{
 		db:     db,
+		keys:   keys,
 		logger: logger,
 	}
 }
@@ -27,13 +32,24 @@ func (r *SqlxRepository) HealthCheck(ctx context.Context) error {
 	return r.db.PingContext(ctx)
 }
 
+// CreateUser creates the user. A retried request with the same idempotency key returns
+// the id of the user created by the first one.
 func (r *SqlxRepository) CreateUser(ctx context.Context, name string) (id uint64, err error) {
 	dto := UserDTO{
 		ID:   0,
 		Name: name,
 	}
 
-	err = sqlxutils.NamedGet(ctx, r.db, &dto.ID, insertUserQuery, dto)
+	err = sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		var txErr error
+
+		dto.ID, _, txErr = r.keys.Create(ctx, tx, models.UserResource, dto, func() (uint64, error) {
+			var id uint64
+			return id, sqlxutils.NamedGet(ctx, tx, &id, insertUserQuery, dto)
+		})
+
+		return txErr
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -41,66 +57,211 @@ func (r *SqlxRepository) CreateUser(ctx context.Context, name string) (id uint64
 	return dto.ID, nil
 }
 
-func (r *SqlxRepository) UpdateUser(ctx context.Context, user models.User) (found bool, err error) {
-	dto := UserDTO{ID: user.ID, Name: user.Name}
-	res, err := sqlxutils.NamedExec(ctx, r.db, updateUserQuery, dto)
+// changeErr explains why a conditional change of the user matched no rows.
+func (r *SqlxRepository) changeErr(ctx context.Context, id, version uint64) error {
+	user, err := r.getUserTx(ctx, r.db, id, false)
 	if err != nil {
-		return false, err
+		return err
 	}
 
-	rowsCount, err := res.RowsAffected()
-	if err != nil {
-		return false, err
+	return models.NewVersionMismatchError(models.UserResource, id, version, user.Version)
+}
+
+// UpdateUser updates the user if its version matches user.Version, unless that is zero,
+// and returns the updated user.
+func (r *SqlxRepository) UpdateUser(ctx context.Context, user models.User) (models.User, error) {
+	dto := UserDTO{ID: user.ID, Name: user.Name, Version: user.Version}
+
+	err := sqlxutils.NamedGet(ctx, r.db, &dto, updateUserQuery, dto)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, r.changeErr(ctx, user.ID, user.Version)
+	} else if err != nil {
+		return models.User{}, err
 	}
 
-	return rowsCount != 0, nil
+	return dto.ToModel(), nil
 }
 
-func (r *SqlxRepository) DeleteUser(ctx context.Context, id uint64) error {
-	_, err := sqlxutils.Exec(ctx, r.db, deleteUserQuery, id)
+// DeleteUser soft-deletes the user if its version matches, unless version is zero,
+// keeping it and its event links until it is restored or purged.
+func (r *SqlxRepository) DeleteUser(ctx context.Context, id, version uint64) error {
+	res, err := sqlxutils.Exec(ctx, r.db, deleteUserQuery, sqlxutils.Now(), id, version)
+	if err != nil {
+		return err
+	}
+
+	rowsCount, err := res.RowsAffected()
+	if err != nil {
+		return err
+	} else if rowsCount == 0 {
+		return r.changeErr(ctx, id, version)
+	}
 
-	return err
+	return nil
 }
 
-func (r *SqlxRepository) GetUser(ctx context.Context, id uint64) (user models.User, found bool, err error) {
+func (*SqlxRepository) getUserTx(ctx context.Context, tx sqlx.QueryerContext, id uint64, showDeleted bool) (models.User, error) {
 	var dto UserDTO
 
-	err = sqlxutils.Get(ctx, r.db, &dto, selectUserQuery, id)
+	err := sqlxutils.Get(ctx, tx, &dto, selectUserQuery, id, showDeleted)
 	if errors.Is(err, sql.ErrNoRows) {
-		return models.User{}, false, nil
+		return models.User{}, models.NewNotFoundError(models.UserResource, id)
 	} else if err != nil {
-		return models.User{}, false, err
+		return models.User{}, err
+	}
+
+	return dto.ToModel(), nil
+}
+
+func (r *SqlxRepository) GetUser(ctx context.Context, id uint64, showDeleted bool) (models.User, error) {
+	return r.getUserTx(ctx, r.db, id, showDeleted)
+}
+
+// RestoreUser undoes the soft deletion of the user and returns it.
+func (r *SqlxRepository) RestoreUser(ctx context.Context, id uint64) (models.User, error) {
+	var user models.User
+
+	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		res, err := sqlxutils.Exec(ctx, tx, restoreUserQuery, id)
+		if err != nil {
+			return err
+		}
+
+		rowsCount, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		user, err = r.getUserTx(ctx, tx, id, true)
+		if err != nil {
+			return err
+		} else if rowsCount == 0 {
+			return &models.FailedPreconditionError{Subject: "id", Description: "user is not deleted"}
+		}
+
+		return nil
+	})
+
+	return user, err
+}
+
+// PurgeUsers hard-deletes users soft-deleted before the given time along with their event links.
+func (r *SqlxRepository) PurgeUsers(ctx context.Context, before time.Time) (int64, error) {
+	res, err := sqlxutils.Exec(ctx, r.db, purgeUsersQuery, before.UTC())
+	if err != nil {
+		return 0, err
 	}
 
-	return dto.ToModel(), true, nil
+	return res.RowsAffected()
 }
 
-func (r *SqlxRepository) GetUsers(ctx context.Context, limit, offset uint64) ([]models.User, uint64, error) {
+func (*SqlxRepository) getUsersTx(
+	ctx context.Context,
+	tx sqlx.QueryerContext,
+	page models.Page,
+	selectQuery, countQuery string,
+	filter ...any,
+) ([]models.User, uint64, error) {
 	res := make(UsersDTO, 0)
 
-	err := sqlxutils.Select(ctx, r.db, &res, selectUsersQuery, limit, offset)
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil, 0, nil
-	} else if err != nil {
+	args := slices.Concat(filter, []any{page.After.ID, page.Limit, page.Offset})
+
+	err := sqlxutils.Select(ctx, tx, &res, selectQuery, args...)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return nil, 0, err
 	}
 
-	model, totalCount := res.ToModel()
+	var totalCount uint64
+
+	if page.WithTotalCount {
+		err = sqlxutils.Get(ctx, tx, &totalCount, countQuery, filter...)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
 
-	return model, totalCount, nil
+	return res.ToModel(), totalCount, nil
 }
 
-func (r *SqlxRepository) GetUsersByEvent(ctx context.Context, eventID, limit, offset uint64) ([]models.User, uint64, error) {
-	res := make(UsersDTO, 0)
+func (r *SqlxRepository) GetUsers(ctx context.Context, page models.Page) ([]models.User, uint64, error) {
+	var (
+		users      []models.User
+		totalCount uint64
+	)
 
-	err := sqlxutils.Select(ctx, r.db, &res, selectUsersByEventQuery, eventID, limit, offset)
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil, 0, nil
-	} else if err != nil {
-		return nil, 0, err
+	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		var txErr error
+		users, totalCount, txErr = r.getUsersTx(ctx, tx, page, selectUsersQuery, countUsersQuery, page.ShowDeleted)
+		return txErr
+	})
+
+	return users, totalCount, err
+}
+
+func (r *SqlxRepository) GetUsersByEvent(ctx context.Context, eventID uint64, page models.Page) ([]models.User, uint64, error) {
+	var (
+		users      []models.User
+		totalCount uint64
+	)
+
+	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		var txErr error
+		users, totalCount, txErr = r.getUsersTx(ctx, tx, page, selectUsersByEventQuery, countUsersByEventQuery, eventID, page.ShowDeleted)
+		return txErr
+	})
+
+	return users, totalCount, err
+}
+
+// CreateUsers inserts users in one transaction, one row per statement, so every id belongs to
+// the user at the same position. In atomic mode any error rolls back the whole batch; in best-effort
+// mode every row is inserted in its own savepoint and failures are reported per item.
+func (r *SqlxRepository) CreateUsers(ctx context.Context, names []string, mode models.BatchMode) ([]models.BatchResult, error) {
+	results := make([]models.BatchResult, 0, len(names))
+
+	err := sqlxutils.RunTx(ctx, r.db, sql.LevelDefault, func(ctx context.Context, tx *sqlxutils.Tx) error {
+		for _, name := range names {
+			dto := UserDTO{ID: 0, Name: name}
+
+			if mode == models.BatchBestEffort {
+				err := sqlxutils.RunSavepoint(ctx, tx, "batch_item", func() error {
+					return sqlxutils.NamedGet(ctx, tx, &dto.ID, insertUserQuery, dto)
+				})
+				results = append(results, models.BatchResult{ID: dto.ID, Err: err})
+
+				continue
+			}
+
+			err := sqlxutils.NamedGet(ctx, tx, &dto.ID, insertUserQuery, dto)
+			if err != nil {
+				return err
+			}
+
+			results = append(results, models.BatchResult{ID: dto.ID, Err: nil})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	model, totalCount := res.ToModel()
+	return results, nil
+}
+
+// GetUsersByIDs returns the existing users among ids in no particular order.
+func (r *SqlxRepository) GetUsersByIDs(ctx context.Context, ids []uint64, showDeleted bool) ([]models.User, error) {
+	query, args, err := sqlxutils.In(r.db, selectUsersByIDsQuery, ids, showDeleted)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(UsersDTO, 0, len(ids))
+
+	err = sqlxutils.Select(ctx, r.db, &res, query, args...)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
 
-	return model, totalCount, nil
+	return res.ToModel(), nil
 }
@@ -0,0 +1,222 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Inspirate789/grpc-template/internal/models"
+	"github.com/Inspirate789/grpc-template/internal/pkg/dbtest"
+	"github.com/Inspirate789/grpc-template/internal/pkg/idempotency"
+	"github.com/Inspirate789/grpc-template/internal/user/repository"
+	"github.com/Inspirate789/grpc-template/pkg/sqlxutils"
+)
+
+func newRepository(db *sqlxutils.DB) *repository.SqlxRepository {
+	return repository.NewSqlx(db, idempotency.NewStore(db, idempotency.Config{}), slog.New(slog.DiscardHandler))
+}
+
+func createUser(ctx context.Context, t *testing.T, repo *repository.SqlxRepository, name string) uint64 {
+	t.Helper()
+
+	id, err := repo.CreateUser(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+func TestCreateUsersIdentity(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *sqlxutils.DB) {
+		repo := newRepository(db)
+
+		first := createUser(t.Context(), t, repo, "first")
+
+		results, err := repo.CreateUsers(t.Context(), []string{"second", "third"}, models.BatchAtomic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := []uint64{first}
+		for _, result := range results {
+			ids = append(ids, result.ID)
+		}
+
+		if want := []uint64{1, 2, 3}; !slices.Equal(ids, want) {
+			t.Fatalf("got ids %v, want %v", ids, want)
+		}
+
+		users, err := repo.GetUsersByIDs(t.Context(), ids, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names := make(map[uint64]string, len(users))
+		for _, user := range users {
+			names[user.ID] = user.Name
+		}
+
+		if names[1] != "first" || names[2] != "second" || names[3] != "third" {
+			t.Fatalf("got names %v", names)
+		}
+	})
+}
+
+func TestCreateUsersOrder(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *sqlxutils.DB) {
+		repo := newRepository(db)
+
+		names := make([]string, 0, 20)
+		for i := range cap(names) {
+			names = append(names, "user"+strconv.Itoa(i))
+		}
+
+		for _, mode := range []models.BatchMode{models.BatchAtomic, models.BatchBestEffort} {
+			results, err := repo.CreateUsers(t.Context(), names, mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := make([]uint64, 0, len(results))
+			for _, result := range results {
+				ids = append(ids, result.ID)
+			}
+
+			users, err := repo.GetUsersByIDs(t.Context(), ids, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			byID := make(map[uint64]string, len(users))
+			for _, user := range users {
+				byID[user.ID] = user.Name
+			}
+
+			for i, id := range ids {
+				if byID[id] != names[i] {
+					t.Fatalf("got user %d named %q at position %d in mode %d, want %q", id, byID[id], i, mode, names[i])
+				}
+			}
+		}
+	})
+}
+
+func TestCreateUserIdempotencyKey(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *sqlxutils.DB) {
+		repo := newRepository(db)
+		ctx := idempotency.WithKey(t.Context(), "key")
+
+		id := createUser(ctx, t, repo, "user")
+
+		if retried := createUser(ctx, t, repo, "user"); retried != id {
+			t.Fatalf("got id %d for the retried request, want %d", retried, id)
+		}
+
+		var alreadyExists *models.AlreadyExistsError
+
+		_, err := repo.CreateUser(ctx, "other")
+		if !errors.As(err, &alreadyExists) {
+			t.Fatalf("got error %v for another payload, want AlreadyExists", err)
+		}
+
+		if other := createUser(t.Context(), t, repo, "user"); other == id {
+			t.Fatalf("got id %d of the first user without a key", other)
+		}
+	})
+}
+
+func TestUpdateUserVersion(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *sqlxutils.DB) {
+		repo := newRepository(db)
+		id := createUser(t.Context(), t, repo, "user")
+
+		updated, err := repo.UpdateUser(t.Context(), models.User{ID: id, Name: "renamed", Version: 1})
+		if err != nil {
+			t.Fatal(err)
+		} else if updated.Name != "renamed" || updated.Version != 2 {
+			t.Fatalf("got %+v, want renamed user of version 2", updated)
+		}
+
+		var mismatch *models.VersionMismatchError
+
+		_, err = repo.UpdateUser(t.Context(), models.User{ID: id, Name: "stale", Version: 1})
+		if !errors.As(err, &mismatch) {
+			t.Fatalf("got error %v for a stale version, want VersionMismatch", err)
+		}
+	})
+}
+
+func TestDeleteAndPurgeUser(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *sqlxutils.DB) {
+		repo := newRepository(db)
+		id := createUser(t.Context(), t, repo, "user")
+
+		before := time.Now().Truncate(time.Second)
+
+		err := repo.DeleteUser(t.Context(), id, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var notFound *models.NotFoundError
+
+		_, err = repo.GetUser(t.Context(), id, false)
+		if !errors.As(err, &notFound) {
+			t.Fatalf("got error %v for a deleted user, want NotFound", err)
+		}
+
+		user, err := repo.GetUser(t.Context(), id, true)
+		if err != nil {
+			t.Fatal(err)
+		} else if user.DeletedAt == nil || user.DeletedAt.Before(before) || user.DeletedAt.After(time.Now()) {
+			t.Fatalf("got deletion time %v, want the time of the deletion", user.DeletedAt)
+		}
+
+		purged, err := repo.PurgeUsers(t.Context(), before.Add(-time.Second))
+		if err != nil {
+			t.Fatal(err)
+		} else if purged != 0 {
+			t.Fatalf("purged %d users deleted after the boundary", purged)
+		}
+
+		purged, err = repo.PurgeUsers(t.Context(), time.Now().Add(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		} else if purged != 1 {
+			t.Fatalf("purged %d users, want 1", purged)
+		}
+	})
+}
+
+func TestGetUsersPages(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *sqlxutils.DB) {
+		repo := newRepository(db)
+
+		for _, name := range []string{"a", "b", "c"} {
+			createUser(t.Context(), t, repo, name)
+		}
+
+		page := models.Page{Limit: 2, WithTotalCount: true}
+
+		users, total, err := repo.GetUsers(t.Context(), page)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(users) != 2 || total != 3 {
+			t.Fatalf("got %d users of %d, want 2 of 3", len(users), total)
+		}
+
+		page.After = models.Cursor{ID: users[len(users)-1].ID}
+
+		users, _, err = repo.GetUsers(t.Context(), page)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(users) != 1 || users[0].Name != "c" {
+			t.Fatalf("got %+v on the second page, want user c", users)
+		}
+	})
+}
@@ -3,56 +3,130 @@ package usecase
 import (
 	"context"
 	"log/slog"
+	"time"
 
 	"github.com/Inspirate789/grpc-template/internal/models"
+	"github.com/Inspirate789/grpc-template/internal/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const tracerName = "github.com/Inspirate789/grpc-template/internal/user/usecase"
+
 type Repository interface {
 	HealthCheck(ctx context.Context) error
 	CreateUser(ctx context.Context, name string) (id uint64, err error)
-	UpdateUser(ctx context.Context, user models.User) (found bool, err error)
-	DeleteUser(ctx context.Context, id uint64) error
-	GetUser(ctx context.Context, id uint64) (user models.User, found bool, err error)
-	GetUsers(ctx context.Context, limit, offset uint64) ([]models.User, uint64, error)
-	GetUsersByEvent(ctx context.Context, eventID, limit, offset uint64) ([]models.User, uint64, error)
+	UpdateUser(ctx context.Context, user models.User) (models.User, error)
+	DeleteUser(ctx context.Context, id, version uint64) error
+	GetUser(ctx context.Context, id uint64, showDeleted bool) (models.User, error)
+	GetUsers(ctx context.Context, page models.Page) ([]models.User, uint64, error)
+	GetUsersByEvent(ctx context.Context, eventID uint64, page models.Page) ([]models.User, uint64, error)
+	CreateUsers(ctx context.Context, names []string, mode models.BatchMode) ([]models.BatchResult, error)
+	GetUsersByIDs(ctx context.Context, ids []uint64, showDeleted bool) ([]models.User, error)
+	RestoreUser(ctx context.Context, id uint64) (models.User, error)
+	PurgeUsers(ctx context.Context, before time.Time) (int64, error)
 }
 
 type UseCase struct {
 	repository Repository
+	tracer     trace.Tracer
 	logger     *slog.Logger
 }
 
 func New(repository Repository, logger *slog.Logger) *UseCase {
 	return &UseCase{
 		repository: repository,
+		tracer:     otel.Tracer(tracerName),
 		logger:     logger,
 	}
 }
 
+// HealthCheck is not traced: it runs periodically in the background and is filtered out of gRPC tracing.
 func (u *UseCase) HealthCheck(ctx context.Context) error {
 	return u.repository.HealthCheck(ctx)
 }
 
 func (u *UseCase) CreateUser(ctx context.Context, name string) (id uint64, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.CreateUser")
+	defer func() { tracing.End(span, err) }()
+
 	return u.repository.CreateUser(ctx, name)
 }
 
-func (u *UseCase) UpdateUser(ctx context.Context, user models.User) (found bool, err error) {
+// UpdateUser updates the user if its version matches user.Version, unless that is zero.
+func (u *UseCase) UpdateUser(ctx context.Context, user models.User) (_ models.User, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.UpdateUser")
+	defer func() { tracing.End(span, err) }()
+
 	return u.repository.UpdateUser(ctx, user)
 }
 
-func (u *UseCase) DeleteUser(ctx context.Context, id uint64) error {
-	return u.repository.DeleteUser(ctx, id)
+// DeleteUser soft-deletes the user if its version matches, unless version is zero.
+func (u *UseCase) DeleteUser(ctx context.Context, id, version uint64) (err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.DeleteUser")
+	defer func() { tracing.End(span, err) }()
+
+	return u.repository.DeleteUser(ctx, id, version)
+}
+
+func (u *UseCase) GetUser(ctx context.Context, id uint64, showDeleted bool) (_ models.User, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.GetUser")
+	defer func() { tracing.End(span, err) }()
+
+	return u.repository.GetUser(ctx, id, showDeleted)
+}
+
+func (u *UseCase) RestoreUser(ctx context.Context, id uint64) (_ models.User, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.RestoreUser")
+	defer func() { tracing.End(span, err) }()
+
+	return u.repository.RestoreUser(ctx, id)
+}
+
+// PurgeDeleted hard-deletes users soft-deleted before the given time and returns their number.
+func (u *UseCase) PurgeDeleted(ctx context.Context, before time.Time) (_ int64, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.PurgeDeleted")
+	defer func() { tracing.End(span, err) }()
+
+	return u.repository.PurgeUsers(ctx, before)
 }
 
-func (u *UseCase) GetUser(ctx context.Context, id uint64) (user models.User, found bool, err error) {
-	return u.repository.GetUser(ctx, id)
+func (u *UseCase) GetUsers(ctx context.Context, page models.Page) (_ []models.User, _ uint64, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.GetUsers")
+	defer func() { tracing.End(span, err) }()
+
+	return u.repository.GetUsers(ctx, page)
 }
 
-func (u *UseCase) GetUsers(ctx context.Context, limit, offset uint64) ([]models.User, uint64, error) {
-	return u.repository.GetUsers(ctx, limit, offset)
+func (u *UseCase) GetUsersByEvent(ctx context.Context, eventID uint64, page models.Page) (_ []models.User, _ uint64, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.GetUsersByEvent")
+	defer func() { tracing.End(span, err) }()
+
+	return u.repository.GetUsersByEvent(ctx, eventID, page)
 }
 
-func (u *UseCase) GetUsersByEvent(ctx context.Context, eventID, limit, offset uint64) ([]models.User, uint64, error) {
-	return u.repository.GetUsersByEvent(ctx, eventID, limit, offset)
+func (u *UseCase) BatchCreateUsers(ctx context.Context, names []string, mode models.BatchMode) (_ []models.BatchResult, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.BatchCreateUsers")
+	defer func() { tracing.End(span, err) }()
+
+	return u.repository.CreateUsers(ctx, names, mode)
+}
+
+// BatchGetUsers returns users in the order of ids along with the ids that don't exist.
+func (u *UseCase) BatchGetUsers(
+	ctx context.Context,
+	ids []uint64,
+	showDeleted bool,
+) (users []models.User, missing []uint64, err error) {
+	ctx, span := u.tracer.Start(ctx, "UseCase.BatchGetUsers")
+	defer func() { tracing.End(span, err) }()
+
+	users, err = u.repository.GetUsersByIDs(ctx, ids, showDeleted)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	users, missing = models.OrderByIDs(ids, users, func(user models.User) uint64 { return user.ID })
+
+	return users, missing, nil
 }
@@ -0,0 +1,7 @@
+// Package migrations embeds the migrations of every database driver, each in the directory named after it.
+package migrations
+
+import "embed"
+
+//go:embed sqlite3 postgres
+var FS embed.FS
@@ -0,0 +1,4 @@
+create table if not exists users (
+    id bigint generated by default as identity primary key,
+    name text not null
+);
@@ -0,0 +1,13 @@
+create table if not exists events (
+    id bigint generated by default as identity primary key,
+    name text not null,
+    timestamp timestamptz not null
+);
+
+create table if not exists users_and_events (
+    user_id bigint,
+    event_id bigint,
+    foreign key (user_id) references users(id) on update cascade on delete cascade,
+    foreign key (event_id) references events(id) on update cascade on delete cascade,
+    unique (user_id, event_id)
+);
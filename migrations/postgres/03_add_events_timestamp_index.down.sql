@@ -0,0 +1 @@
+drop index if exists events_timestamp_id_idx;
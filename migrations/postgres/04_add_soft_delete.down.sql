@@ -0,0 +1,8 @@
+delete from events where deleted_at is not null;
+delete from users where deleted_at is not null;
+
+drop index if exists events_deleted_at_idx;
+drop index if exists users_deleted_at_idx;
+
+alter table events drop column deleted_at;
+alter table users drop column deleted_at;
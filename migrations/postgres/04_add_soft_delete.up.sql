@@ -0,0 +1,5 @@
+alter table users add column deleted_at timestamptz;
+alter table events add column deleted_at timestamptz;
+
+create index if not exists users_deleted_at_idx on users(deleted_at);
+create index if not exists events_deleted_at_idx on events(deleted_at);
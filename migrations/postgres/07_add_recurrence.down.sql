@@ -0,0 +1,5 @@
+drop table if exists event_occurrences;
+
+alter table events drop column exdates;
+alter table events drop column time_zone;
+alter table events drop column rrule;
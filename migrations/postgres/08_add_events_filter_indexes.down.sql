@@ -0,0 +1,3 @@
+drop index if exists users_and_events_event_id_user_id_idx;
+drop index if exists events_lower_name_idx;
+drop index if exists events_name_id_idx;
@@ -0,0 +1,4 @@
+create index if not exists events_name_id_idx on events(name, id);
+-- text_pattern_ops lets name prefix searches use the index regardless of the collation.
+create index if not exists events_lower_name_idx on events(lower(name) text_pattern_ops);
+create index if not exists users_and_events_event_id_user_id_idx on users_and_events(event_id, user_id);
@@ -0,0 +1,2 @@
+drop table if exists users_and_events;
+drop table if exists events;
@@ -0,0 +1 @@
+create index if not exists events_timestamp_id_idx on events(timestamp, id);
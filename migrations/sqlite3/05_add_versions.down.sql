@@ -0,0 +1,2 @@
+alter table events drop column version;
+alter table users drop column version;
@@ -0,0 +1,2 @@
+alter table users add column version integer not null default 1;
+alter table events add column version integer not null default 1;
@@ -0,0 +1,10 @@
+create table if not exists idempotency_keys (
+    scope text not null,
+    idempotency_key text not null,
+    request_hash text not null,
+    resource_id integer not null,
+    expires_at timestamp not null,
+    primary key (scope, idempotency_key)
+);
+
+create index if not exists idempotency_keys_expires_at_idx on idempotency_keys(expires_at);
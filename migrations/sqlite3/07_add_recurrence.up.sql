@@ -0,0 +1,12 @@
+alter table events add column rrule text;
+alter table events add column time_zone text;
+alter table events add column exdates text;
+
+create table if not exists event_occurrences (
+    event_id integer not null,
+    recurrence_id timestamp not null,
+    name text not null,
+    timestamp timestamp not null,
+    primary key (event_id, recurrence_id),
+    foreign key (event_id) references events(id) on update cascade on delete cascade
+);
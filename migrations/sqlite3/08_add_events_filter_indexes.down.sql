@@ -0,0 +1,2 @@
+drop index if exists users_and_events_event_id_user_id_idx;
+drop index if exists events_name_id_idx;
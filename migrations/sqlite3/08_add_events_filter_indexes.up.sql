@@ -0,0 +1,3 @@
+create index if not exists events_name_id_idx on events(name, id);
+-- Unlike PostgreSQL, SQLite doesn't use an index for lower(name) like ?, so name patterns are matched by a scan.
+create index if not exists users_and_events_event_id_user_id_idx on users_and_events(event_id, user_id);
@@ -1,19 +1,19 @@
-insert into users(name) values ('aboba1');
-insert into users(name) values ('aboba2');
-insert into users(name) values ('aboba3');
-insert into users(name) values ('aboba4');
-insert into users(name) values ('aboba5');
+insert into users(id, name) values (1, 'aboba1') on conflict do nothing;
+insert into users(id, name) values (2, 'aboba2') on conflict do nothing;
+insert into users(id, name) values (3, 'aboba3') on conflict do nothing;
+insert into users(id, name) values (4, 'aboba4') on conflict do nothing;
+insert into users(id, name) values (5, 'aboba5') on conflict do nothing;
 
-insert into events(name, timestamp) values ('event1', current_timestamp);
-insert into events(name, timestamp) values ('event2', current_timestamp);
-insert into events(name, timestamp) values ('event3', current_timestamp);
-insert into events(name, timestamp) values ('event4', current_timestamp);
-insert into events(name, timestamp) values ('event5', current_timestamp);
+insert into events(id, name, timestamp) values (1, 'event1', '2025-01-01T10:00:00Z') on conflict do nothing;
+insert into events(id, name, timestamp) values (2, 'event2', '2025-01-02T10:00:00Z') on conflict do nothing;
+insert into events(id, name, timestamp) values (3, 'event3', '2025-01-03T10:00:00Z') on conflict do nothing;
+insert into events(id, name, timestamp) values (4, 'event4', '2025-01-04T10:00:00Z') on conflict do nothing;
+insert into events(id, name, timestamp) values (5, 'event5', '2025-01-05T10:00:00Z') on conflict do nothing;
 
-insert into users_and_events(user_id, event_id) values (1, 1);
-insert into users_and_events(user_id, event_id) values (1, 2);
-insert into users_and_events(user_id, event_id) values (2, 2);
-insert into users_and_events(user_id, event_id) values (3, 2);
-insert into users_and_events(user_id, event_id) values (5, 4);
-insert into users_and_events(user_id, event_id) values (2, 4);
-insert into users_and_events(user_id, event_id) values (4, 3);
+insert into users_and_events(user_id, event_id) values (1, 1) on conflict do nothing;
+insert into users_and_events(user_id, event_id) values (1, 2) on conflict do nothing;
+insert into users_and_events(user_id, event_id) values (2, 2) on conflict do nothing;
+insert into users_and_events(user_id, event_id) values (3, 2) on conflict do nothing;
+insert into users_and_events(user_id, event_id) values (5, 4) on conflict do nothing;
+insert into users_and_events(user_id, event_id) values (2, 4) on conflict do nothing;
+insert into users_and_events(user_id, event_id) values (4, 3) on conflict do nothing;
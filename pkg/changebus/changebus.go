@@ -0,0 +1,174 @@
+package changebus
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+var (
+	ErrSlowConsumer    = errors.New("subscriber is too slow to receive changes")
+	ErrRevisionTooOld  = errors.New("requested revision is no longer retained")
+	ErrRevisionTooNew  = errors.New("requested revision has not been published yet")
+	ErrRevisionUnknown = errors.New("requested revision was published by another bus, e.g. before a restart")
+)
+
+// A revision carries the epoch of the bus in its upper bits and the number of the change in the lower ones.
+// The epoch is random for every bus, so a revision published by another process, e.g. before a restart
+// or by another replica, isn't mistaken for one of this bus.
+const (
+	epochShift = 32
+	numberMask = 1<<epochShift - 1
+)
+
+// newEpoch returns random upper bits of revisions.
+func newEpoch() uint64 {
+	var data [4]byte
+
+	// crypto/rand.Read never returns an error.
+	_, _ = rand.Read(data[:])
+
+	return uint64(binary.BigEndian.Uint32(data[:])) << epochShift
+}
+
+type Change[T any] struct {
+	Revision uint64
+	Value    T
+}
+
+// Subscription receives every change published after it was created.
+// C is closed when the subscription is dropped; Err reports the reason.
+type Subscription[T any] struct {
+	C   <-chan Change[T]
+	ch  chan Change[T]
+	bus *Bus[T]
+	err error
+}
+
+func (s *Subscription[T]) Err() error {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	return s.err
+}
+
+func (s *Subscription[T]) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	s.bus.drop(s, nil)
+}
+
+// Bus is an in-process fan-out of revisioned changes. It keeps a bounded history,
+// so subscribers can resume from a known revision after reconnecting.
+type Bus[T any] struct {
+	mu sync.Mutex
+	// revision is the last published revision, or the epoch before the first change.
+	revision    uint64
+	history     []Change[T]
+	historySize int
+	bufferSize  int
+	subscribers map[*Subscription[T]]struct{}
+}
+
+// New creates a bus retaining historySize last changes and buffering up to bufferSize changes per subscriber.
+// Non-positive sizes are treated as 1.
+func New[T any](historySize, bufferSize int) *Bus[T] {
+	historySize = max(historySize, 1)
+
+	return &Bus[T]{
+		revision:    newEpoch(),
+		history:     make([]Change[T], 0, historySize),
+		historySize: historySize,
+		bufferSize:  max(bufferSize, 1),
+		subscribers: make(map[*Subscription[T]]struct{}),
+	}
+}
+
+func (b *Bus[T]) drop(sub *Subscription[T], err error) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+
+	delete(b.subscribers, sub)
+	sub.err = err
+	close(sub.ch)
+}
+
+// Publish assigns the next revision to the value and delivers it to all subscribers.
+// Subscribers whose buffer is full are dropped with ErrSlowConsumer instead of blocking the publisher.
+// Once the numbers of an epoch run out, the bus starts a new one and forgets its history.
+func (b *Bus[T]) Publish(value T) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.revision&numberMask == numberMask {
+		b.revision = newEpoch()
+		b.history = b.history[:0]
+	}
+
+	b.revision++
+	change := Change[T]{Revision: b.revision, Value: value}
+
+	if len(b.history) == b.historySize {
+		copy(b.history, b.history[1:])
+		b.history = b.history[:len(b.history)-1]
+	}
+
+	b.history = append(b.history, change)
+
+	for sub := range b.subscribers {
+		select {
+		case sub.ch <- change:
+		default:
+			b.drop(sub, ErrSlowConsumer)
+		}
+	}
+
+	return b.revision
+}
+
+func (b *Bus[T]) Revision() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.revision
+}
+
+// Subscribe registers a new subscriber. If after is not nil, the retained changes with
+// greater revisions are returned as a backlog, which must be processed before reading from C.
+// A revision of another epoch fails with ErrRevisionUnknown.
+func (b *Bus[T]) Subscribe(after *uint64) (*Subscription[T], []Change[T], error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var backlog []Change[T]
+
+	if after != nil {
+		switch {
+		case *after&^numberMask != b.revision&^numberMask:
+			return nil, nil, ErrRevisionUnknown
+		case *after > b.revision:
+			return nil, nil, ErrRevisionTooNew
+		case *after < b.revision && (len(b.history) == 0 || b.history[0].Revision > *after+1):
+			return nil, nil, ErrRevisionTooOld
+		}
+
+		for _, change := range b.history {
+			if change.Revision > *after {
+				backlog = append(backlog, change)
+			}
+		}
+	}
+
+	ch := make(chan Change[T], b.bufferSize)
+	sub := &Subscription[T]{
+		C:   ch,
+		ch:  ch,
+		bus: b,
+	}
+	b.subscribers[sub] = struct{}{}
+
+	return sub, backlog, nil
+}
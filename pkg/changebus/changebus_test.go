@@ -0,0 +1,71 @@
+package changebus_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Inspirate789/grpc-template/pkg/changebus"
+)
+
+func publish(bus *changebus.Bus[int], count int) []uint64 {
+	revisions := make([]uint64, 0, count)
+	for i := range count {
+		revisions = append(revisions, bus.Publish(i))
+	}
+
+	return revisions
+}
+
+func TestSubscribeResume(t *testing.T) {
+	bus := changebus.New[int](10, 10)
+	revisions := publish(bus, 3)
+
+	sub, backlog, err := bus.Subscribe(&revisions[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	if len(backlog) != 2 || backlog[0].Revision != revisions[1] || backlog[1].Value != 2 {
+		t.Fatalf("got backlog %+v after revision %d, want the changes of %v", backlog, revisions[0], revisions[1:])
+	}
+
+	revision := bus.Publish(3)
+
+	change := <-sub.C
+	if change.Revision != revision || change.Value != 3 {
+		t.Fatalf("got change %+v, want value 3 of revision %d", change, revision)
+	}
+}
+
+func TestSubscribeRetainedRevisions(t *testing.T) {
+	bus := changebus.New[int](2, 10)
+	revisions := publish(bus, 4)
+
+	_, _, err := bus.Subscribe(&revisions[0])
+	if !errors.Is(err, changebus.ErrRevisionTooOld) {
+		t.Fatalf("got error %v for a dropped revision, want ErrRevisionTooOld", err)
+	}
+
+	tooNew := revisions[3] + 1
+
+	_, _, err = bus.Subscribe(&tooNew)
+	if !errors.Is(err, changebus.ErrRevisionTooNew) {
+		t.Fatalf("got error %v for an unpublished revision, want ErrRevisionTooNew", err)
+	}
+}
+
+func TestSubscribeResumeAcrossBuses(t *testing.T) {
+	stale := publish(changebus.New[int](10, 10), 3)
+
+	// The bus of a restarted process has published more changes than the client received before.
+	bus := changebus.New[int](10, 10)
+	publish(bus, 5)
+
+	for _, revision := range stale {
+		_, _, err := bus.Subscribe(&revision)
+		if !errors.Is(err, changebus.ErrRevisionUnknown) {
+			t.Fatalf("got error %v for revision %d of another bus, want ErrRevisionUnknown", err, revision)
+		}
+	}
+}
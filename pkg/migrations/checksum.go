@@ -0,0 +1,137 @@
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"slices"
+	"time"
+)
+
+// checksum hashes the up migration of the version.
+func (m *Migrator) checksum(version uint) (string, error) {
+	r, _, err := m.source.ReadUp(version)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, r)
+	if err != nil {
+		return "", errors.Join(err, r.Close())
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), r.Close()
+}
+
+func (m *Migrator) checksums(ctx context.Context) (map[uint]string, error) {
+	rows, err := m.db.QueryContext(ctx, selectChecksumsQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	checksums := make(map[uint]string)
+
+	for rows.Next() {
+		var (
+			version  uint
+			checksum string
+		)
+
+		err = rows.Scan(&version, &checksum)
+		if err != nil {
+			return nil, errors.Join(err, rows.Close())
+		}
+
+		checksums[version] = checksum
+	}
+
+	return checksums, errors.Join(rows.Err(), rows.Close())
+}
+
+// changed returns the applied migrations up to the version whose files were changed or removed after they
+// were applied.
+func (m *Migrator) changed(ctx context.Context, version int) ([]uint, error) {
+	checksums, err := m.checksums(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make([]uint, 0)
+
+	for _, v := range slices.Sorted(maps.Keys(checksums)) {
+		if int(v) > version {
+			break
+		}
+
+		checksum, checksumErr := m.checksum(v)
+		if errors.Is(checksumErr, fs.ErrNotExist) || checksumErr == nil && checksum != checksums[v] {
+			changed = append(changed, v)
+		} else if checksumErr != nil {
+			return nil, checksumErr
+		}
+	}
+
+	return changed, nil
+}
+
+// checkDrift fails or warns, depending on Config.OnDrift, if applied migrations were changed.
+func (m *Migrator) checkDrift(ctx context.Context, version int) error {
+	changed, err := m.changed(ctx, version)
+	if err != nil || len(changed) == 0 {
+		return err
+	}
+
+	message := fmt.Sprintf("migrations %v were changed or removed after they were applied", changed)
+	if m.config.OnDrift == OnDriftWarn {
+		m.logger.Warn(message)
+		return nil
+	}
+
+	return errors.New(message + "; restore them or run migrate force to accept the changes")
+}
+
+// record removes the checksums of the migrations after the version and records the ones of the applied
+// migrations that miss them, e.g. the ones applied before the checksums were tracked.
+func (m *Migrator) record(ctx context.Context, version int) error {
+	_, err := m.db.ExecContext(ctx, deleteChecksumsQuery, version)
+	if err != nil {
+		return err
+	}
+
+	checksums, err := m.checksums(ctx)
+	if err != nil {
+		return err
+	}
+
+	applied, err := m.migrations(NilVersion, version)
+	if err != nil {
+		return err
+	}
+
+	appliedAt := time.Now().UTC().Format(time.RFC3339)
+
+	for _, migration := range applied {
+		if _, ok := checksums[migration.Version]; ok {
+			continue
+		}
+
+		checksum, checksumErr := m.checksum(migration.Version)
+		if checksumErr != nil {
+			return checksumErr
+		}
+
+		_, err = m.db.ExecContext(ctx, insertChecksumQuery, migration.Version, checksum, appliedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
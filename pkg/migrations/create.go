@@ -0,0 +1,76 @@
+package migrations
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// Drivers are the supported database drivers; each of them has a directory of migrations.
+var Drivers = []string{"sqlite3", "postgres"}
+
+var migrationName = regexp.MustCompile(`^[a-z0-9]+(_[a-z0-9]+)*$`)
+
+// lastVersion returns the latest version of the migrations in dir, or NilVersion if there are none.
+func lastVersion(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	last := NilVersion
+
+	for _, entry := range entries {
+		migration, parseErr := source.Parse(entry.Name())
+		if parseErr == nil && int(migration.Version) > last {
+			last = int(migration.Version)
+		}
+	}
+
+	return last, nil
+}
+
+// Create adds empty up and down migrations with the name to the directories of all drivers in migrationsPath.
+// They get the version after the latest migration of any driver, so the drivers keep the same versions.
+// It returns the paths of the created files.
+func Create(migrationsPath, name string) ([]string, error) {
+	if !migrationName.MatchString(name) {
+		return nil, fmt.Errorf("invalid migration name %q, expected snake case", name)
+	}
+
+	last := NilVersion
+
+	for _, driverName := range Drivers {
+		version, err := lastVersion(filepath.Join(migrationsPath, driverName))
+		if err != nil {
+			return nil, err
+		}
+
+		last = max(last, version)
+	}
+
+	paths := make([]string, 0, len(Drivers)*2)
+
+	for _, driverName := range Drivers {
+		for _, direction := range []source.Direction{source.Up, source.Down} {
+			path := filepath.Join(migrationsPath, driverName, fmt.Sprintf("%02d_%s.%s.sql", last+1, name, direction))
+
+			file, err := os.OpenFile(filepath.Clean(path), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+			if err != nil {
+				return paths, err
+			}
+
+			err = file.Close()
+			if err != nil {
+				return paths, err
+			}
+
+			paths = append(paths, path)
+		}
+	}
+
+	return paths, nil
+}
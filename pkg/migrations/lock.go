@@ -0,0 +1,191 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// advisoryLockID is an arbitrary key that differs from the ones migrate locks around every operation,
+// so the lock can be held over several of them.
+const advisoryLockID int64 = 0x6d69677261746573
+
+const lockPollInterval = time.Second
+
+// lockRefreshes is how many times the SQLite lock is refreshed within Config.LockTimeout.
+const lockRefreshes = 3
+
+func lockOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return hostname + ":" + strconv.Itoa(os.Getpid())
+}
+
+// lock makes other instances wait until the returned function releases the lock,
+// so only one of them migrates the database.
+func (m *Migrator) lock(ctx context.Context) (func() error, error) {
+	if m.driverName == "postgres" {
+		return m.lockPostgres(ctx)
+	}
+
+	return m.lockSQLite(ctx)
+}
+
+func (m *Migrator) lockPostgres(ctx context.Context) (func() error, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var locked bool
+
+	err = conn.QueryRowContext(ctx, tryAdvisoryLockQuery, advisoryLockID).Scan(&locked)
+	if err == nil && !locked {
+		m.logger.Info("waiting for another instance to finish migrating")
+
+		_, err = conn.ExecContext(ctx, advisoryLockQuery, advisoryLockID)
+	}
+
+	if err != nil {
+		return nil, errors.Join(err, conn.Close())
+	}
+
+	return func() error {
+		_, err := conn.ExecContext(context.WithoutCancel(ctx), advisoryUnlockQuery, advisoryLockID)
+		return errors.Join(err, conn.Close())
+	}, nil
+}
+
+func (m *Migrator) lockSQLite(ctx context.Context) (func() error, error) {
+	_, err := m.db.ExecContext(ctx, createLockTableQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	owner := lockOwner()
+
+	for waiting := false; ; waiting = true {
+		acquired, err := m.tryLockSQLite(ctx, owner)
+		if err != nil {
+			return nil, err
+		} else if acquired {
+			break
+		}
+
+		if !waiting {
+			m.logger.Info("waiting for another instance to finish migrating")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+
+	refreshCtx, stopRefreshing := context.WithCancel(context.WithoutCancel(ctx))
+	refreshed := make(chan struct{})
+
+	go func() {
+		m.refreshLockSQLite(refreshCtx, owner)
+		close(refreshed)
+	}()
+
+	return func() error {
+		stopRefreshing()
+		<-refreshed
+
+		_, err := m.db.ExecContext(context.WithoutCancel(ctx), deleteLockQuery, owner)
+
+		return err
+	}, nil
+}
+
+// refreshLockSQLite updates the time of the lock held by owner until ctx is done, so other instances
+// don't take over the lock of a migration lasting longer than Config.LockTimeout.
+func (m *Migrator) refreshLockSQLite(ctx context.Context, owner string) {
+	ticker := time.NewTicker(m.config.LockTimeout / lockRefreshes)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			res, err := m.db.ExecContext(ctx, refreshLockQuery, now.UTC().Format(time.RFC3339), owner)
+			if errors.Is(err, context.Canceled) {
+				return
+			} else if err != nil {
+				m.logger.Warn("refresh the migration lock: " + err.Error())
+				continue
+			}
+
+			rowsCount, err := res.RowsAffected()
+			if err == nil && rowsCount == 0 {
+				m.logger.Warn("the migration lock was taken over by another instance")
+			}
+		}
+	}
+}
+
+// tryLockSQLite claims the lock row in an exclusive transaction, so two instances can't claim it at once.
+// A lock older than Config.LockTimeout is taken over as left by a crashed instance.
+func (m *Migrator) tryLockSQLite(ctx context.Context, owner string) (acquired bool, err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	defer func() {
+		err = errors.Join(err, conn.Close())
+	}()
+
+	_, err = conn.ExecContext(ctx, "begin exclusive")
+	if err != nil {
+		return false, err
+	}
+
+	defer func() {
+		if !acquired {
+			_, rollbackErr := conn.ExecContext(context.WithoutCancel(ctx), "rollback")
+			err = errors.Join(err, rollbackErr)
+		}
+	}()
+
+	var holder, lockedAt string
+
+	err = conn.QueryRowContext(ctx, selectLockQuery).Scan(&holder, &lockedAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return false, err
+	default:
+		lockTime, parseErr := time.Parse(time.RFC3339, lockedAt)
+		if parseErr != nil {
+			return false, parseErr
+		} else if time.Since(lockTime) < m.config.LockTimeout {
+			return false, nil
+		}
+
+		m.logger.Warn(fmt.Sprintf("taking over the migration lock held by %s since %s", holder, lockedAt))
+	}
+
+	_, err = conn.ExecContext(ctx, upsertLockQuery, owner, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return false, err
+	}
+
+	_, err = conn.ExecContext(ctx, "commit")
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -1,60 +1,76 @@
 package migrations
 
 import (
-	"errors"
+	"context"
+	"database/sql"
 	"fmt"
+	"io/fs"
 	"log/slog"
 
-	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
 )
 
-func up(migrator *migrate.Migrate, version uint, logger *slog.Logger) error {
-	err := migrator.Up()
-	switch {
-	case err != nil && !errors.Is(err, migrate.ErrNoChange):
-		rollbackErr := migrator.Force(int(version))
-		if rollbackErr != nil {
-			logger.Warn(err.Error() + "; rollback")
-			logger.Warn("rollback migration")
-			return rollbackErr
-		}
-
-		logger.Warn("rollback migration")
-
-		return err
-	case errors.Is(err, migrate.ErrNoChange):
-		logger.Info("current database migration version is up to date")
+func NewDatabaseDriver(driverName string, db *sql.DB) (database.Driver, error) {
+	switch driverName {
+	case "sqlite3":
+		return sqlite3.WithInstance(db, &sqlite3.Config{})
+	case "postgres":
+		return postgres.WithInstance(db, &postgres.Config{})
 	default:
-		var dirty bool
-
-		version, dirty, err = migrator.Version()
-		if err != nil {
-			return err
-		} else if dirty {
-			return fmt.Errorf("database migration version %d is dirty", version)
-		}
+		return nil, fmt.Errorf("unsupported database driver %q", driverName)
+	}
+}
 
-		logger.Info(fmt.Sprintf("migrated to version %d", version))
+// Do applies pending migrations from the root of migrationsFS, see Migrator.Up.
+func Do(
+	ctx context.Context,
+	driverName string,
+	migrationsFS fs.FS,
+	db *sql.DB,
+	config Config,
+	logger *slog.Logger,
+) error {
+	migrator, err := New(ctx, driverName, migrationsFS, db, config, logger)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return migrator.Up(ctx, 0)
 }
 
-func Do(driverName, migrationsPath string, dbInstance database.Driver, logger *slog.Logger) error {
-	migrator, err := migrate.NewWithDatabaseInstance("file://"+migrationsPath, driverName, dbInstance)
+// Check reports a dirty database and changed migrations and warns about pending ones,
+// for the app started without migrating.
+func Check(
+	ctx context.Context,
+	driverName string,
+	migrationsFS fs.FS,
+	db *sql.DB,
+	config Config,
+	logger *slog.Logger,
+) error {
+	migrator, err := New(ctx, driverName, migrationsFS, db, config, logger)
+	if err != nil {
+		return err
+	}
+
+	status, err := migrator.Status(ctx)
 	if err != nil {
 		return err
+	} else if status.Dirty {
+		return fmt.Errorf("current database migration version %d is dirty", status.Version)
 	}
 
-	version, dirty, err := migrator.Version()
-	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+	err = migrator.checkDrift(ctx, status.Version)
+	if err != nil {
 		return err
-	} else if dirty {
-		return fmt.Errorf("current database migration version %d is dirty", version)
 	}
 
-	logger.Info(fmt.Sprintf("current database migration version is %d; migrate up", version))
+	if len(status.Pending) != 0 {
+		logger.Warn(fmt.Sprintf("current database migration version is %d; %d migrations are pending",
+			status.Version, len(status.Pending)))
+	}
 
-	return up(migrator, version, logger)
+	return nil
 }
@@ -0,0 +1,361 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// NilVersion is the version of a database without applied migrations.
+const NilVersion = database.NilVersion
+
+const (
+	// OnDriftFail refuses to migrate when applied migrations were changed.
+	OnDriftFail = "fail"
+	// OnDriftWarn only logs changed migrations.
+	OnDriftWarn = "warn"
+)
+
+const defaultLockTimeout = 10 * time.Minute
+
+type Config struct {
+	// OnDrift is "fail" (default) or "warn": what to do when a migration was changed or removed after
+	// it was applied.
+	OnDrift string
+	// LockTimeout is how long the SQLite migration lock is respected, 10 minutes by default. The instance
+	// holding the lock refreshes it several times within LockTimeout, so a lock that wasn't refreshed
+	// for longer is taken over as left by a crashed instance.
+	LockTimeout time.Duration
+}
+
+type Migration struct {
+	Version uint
+	Name    string
+}
+
+type Status struct {
+	// Version is the current database version or NilVersion.
+	Version int
+	Dirty   bool
+	// Pending are the migrations after Version.
+	Pending []Migration
+	// Changed are the versions of the applied migrations that were changed or removed after they were applied.
+	Changed []uint
+}
+
+// migrateLogger passes the messages of migrate about applied migrations to slog.
+type migrateLogger struct {
+	logger *slog.Logger
+}
+
+func (l migrateLogger) Printf(format string, v ...any) {
+	l.logger.Info("applied migration " + strings.TrimSpace(fmt.Sprintf(format, v...)))
+}
+
+func (l migrateLogger) Verbose() bool {
+	return false
+}
+
+type Migrator struct {
+	migrate    *migrate.Migrate
+	source     source.Driver
+	db         *sql.DB
+	driverName string
+	config     Config
+	logger     *slog.Logger
+}
+
+// New creates a Migrator for the migrations in the root of migrationsFS.
+func New(
+	ctx context.Context,
+	driverName string,
+	migrationsFS fs.FS,
+	db *sql.DB,
+	config Config,
+	logger *slog.Logger,
+) (*Migrator, error) {
+	if config.OnDrift == "" {
+		config.OnDrift = OnDriftFail
+	} else if config.OnDrift != OnDriftFail && config.OnDrift != OnDriftWarn {
+		return nil, fmt.Errorf("unsupported onDrift %q, expected %q or %q", config.OnDrift, OnDriftFail, OnDriftWarn)
+	}
+
+	if config.LockTimeout <= 0 {
+		config.LockTimeout = defaultLockTimeout
+	}
+
+	dbInstance, err := NewDatabaseDriver(driverName, db)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceDriver, err := iofs.New(migrationsFS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	migrator, err := migrate.NewWithInstance("iofs", sourceDriver, driverName, dbInstance)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator.Log = migrateLogger{logger: logger}
+
+	_, err = db.ExecContext(ctx, createChecksumsTableQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		migrate:    migrator,
+		source:     sourceDriver,
+		db:         db,
+		driverName: driverName,
+		config:     config,
+		logger:     logger,
+	}, nil
+}
+
+func (m *Migrator) version() (int, bool, error) {
+	version, dirty, err := m.migrate.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return NilVersion, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+
+	return int(version), dirty, nil
+}
+
+// migrations returns the migrations with versions in (from, to].
+func (m *Migrator) migrations(from, to int) ([]Migration, error) {
+	migrations := make([]Migration, 0)
+
+	next, err := m.source.First()
+	for ; err == nil && int(next) <= to; next, err = m.source.Next(next) {
+		if int(next) <= from {
+			continue
+		}
+
+		r, name, readErr := m.source.ReadUp(next)
+		if readErr != nil {
+			return nil, readErr
+		}
+
+		readErr = r.Close()
+		if readErr != nil {
+			return nil, readErr
+		}
+
+		migrations = append(migrations, Migration{Version: next, Name: name})
+	}
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return migrations, nil
+}
+
+func (m *Migrator) Status(ctx context.Context) (Status, error) {
+	version, dirty, err := m.version()
+	if err != nil {
+		return Status{}, err
+	}
+
+	pending, err := m.migrations(version, math.MaxInt)
+	if err != nil {
+		return Status{}, err
+	}
+
+	changed, err := m.changed(ctx, version)
+	if err != nil {
+		return Status{}, err
+	}
+
+	return Status{
+		Version: version,
+		Dirty:   dirty,
+		Pending: pending,
+		Changed: changed,
+	}, nil
+}
+
+// rollback resets the version of the database after a failed migration. Both drivers run a migration
+// in a transaction, so a failed one leaves no changes and the database stays at the version it was
+// migrated from, while migrate marks it dirty with the target version.
+func (m *Migrator) rollback(err error, from int) error {
+	version, dirty, versionErr := m.migrate.Version()
+	if versionErr != nil || !dirty {
+		return err
+	}
+
+	up := int(version) > from
+
+	var (
+		last      uint
+		sourceErr error
+	)
+
+	if up {
+		last, sourceErr = m.source.Prev(version)
+	} else {
+		last, sourceErr = m.source.Next(version)
+	}
+
+	lastVersion := int(last)
+
+	if up && errors.Is(sourceErr, os.ErrNotExist) {
+		lastVersion = NilVersion
+	} else if sourceErr != nil {
+		return errors.Join(err, sourceErr)
+	}
+
+	forceErr := m.migrate.Force(lastVersion)
+	if forceErr != nil {
+		return errors.Join(err, forceErr)
+	}
+
+	m.logger.Warn(fmt.Sprintf("migration %d failed; database version is reset to %d", version, lastVersion))
+
+	return err
+}
+
+// report logs the migrations run between the versions.
+func (m *Migrator) report(from, to int, elapsed time.Duration) error {
+	if from == to {
+		m.logger.Info(fmt.Sprintf("database migration version %d is up to date", to))
+		return nil
+	}
+
+	migrations, err := m.migrations(min(from, to), max(from, to))
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(migrations))
+	for _, migration := range migrations {
+		names = append(names, strconv.FormatUint(uint64(migration.Version), 10)+" "+migration.Name)
+	}
+
+	action := "applied"
+	if to < from {
+		action = "reverted"
+	}
+
+	m.logger.Info(fmt.Sprintf("migrated database from version %d to %d in %s; %s %s",
+		from, to, elapsed.Round(time.Millisecond), action, strings.Join(names, ", ")))
+
+	return nil
+}
+
+// run migrates the database with operation under the lock, after checking that it isn't dirty and applied
+// migrations weren't changed. Then it records checksums of the applied migrations and reports what ran.
+func (m *Migrator) run(ctx context.Context, operation func() error) (err error) {
+	release, err := m.lock(ctx)
+	if err != nil {
+		return fmt.Errorf("lock migrations: %w", err)
+	}
+
+	defer func() {
+		err = errors.Join(err, release())
+	}()
+
+	from, dirty, err := m.version()
+	if err != nil {
+		return err
+	} else if dirty {
+		return fmt.Errorf("database migration version %d is dirty", from)
+	}
+
+	err = m.checkDrift(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+
+	err = operation()
+	if errors.Is(err, migrate.ErrNoChange) {
+		err = nil
+	} else if err != nil {
+		err = m.rollback(err, from)
+	}
+
+	to, _, versionErr := m.version()
+	if versionErr != nil {
+		return errors.Join(err, versionErr)
+	}
+
+	return errors.Join(err, m.record(ctx, to), m.report(from, to, time.Since(start)))
+}
+
+// Up applies n next migrations or all pending ones if n is zero.
+func (m *Migrator) Up(ctx context.Context, n uint) error {
+	return m.run(ctx, func() error {
+		if n == 0 {
+			return m.migrate.Up()
+		}
+
+		return m.migrate.Steps(int(n))
+	})
+}
+
+// Down reverts n last migrations.
+func (m *Migrator) Down(ctx context.Context, n uint) error {
+	return m.run(ctx, func() error {
+		return m.migrate.Steps(-int(n))
+	})
+}
+
+// Goto migrates up or down to the version.
+func (m *Migrator) Goto(ctx context.Context, version uint) error {
+	return m.run(ctx, func() error {
+		return m.migrate.Migrate(version)
+	})
+}
+
+// Force sets the version and clears the dirty flag without running migrations, e.g. after a failed
+// migration is fixed by hand. The current migration files are accepted as applied, so their changes
+// are no longer reported.
+func (m *Migrator) Force(ctx context.Context, version int) (err error) {
+	release, err := m.lock(ctx)
+	if err != nil {
+		return fmt.Errorf("lock migrations: %w", err)
+	}
+
+	defer func() {
+		err = errors.Join(err, release())
+	}()
+
+	err = m.migrate.Force(version)
+	if err != nil {
+		return err
+	}
+
+	err = m.record(ctx, NilVersion)
+	if err == nil {
+		err = m.record(ctx, version)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	m.logger.Info(fmt.Sprintf("database migration version is forced to %d", version))
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package migrations
+
+// The queries run on both drivers; times are stored as RFC 3339 text.
+const (
+	createChecksumsTableQuery = `
+        /* create_schema_migrations_checksums */
+        create table if not exists schema_migrations_checksums (
+            version    bigint primary key,
+            checksum   text not null,
+            applied_at text not null
+        );
+    `
+	selectChecksumsQuery = `
+        /* select_schema_migrations_checksums */
+        select version, checksum from schema_migrations_checksums order by version;
+    `
+	insertChecksumQuery = `
+        /* insert_schema_migrations_checksum */
+        insert into schema_migrations_checksums(version, checksum, applied_at) values ($1, $2, $3)
+        on conflict (version) do nothing;
+    `
+	// Checksums of reverted migrations are removed, so they are recorded again when applied.
+	deleteChecksumsQuery = `
+        /* delete_schema_migrations_checksums */
+        delete from schema_migrations_checksums where version > $1;
+    `
+)
+
+// The lock of SQLite is a row claimed in an exclusive transaction.
+const (
+	createLockTableQuery = `
+        /* create_schema_migrations_lock */
+        create table if not exists schema_migrations_lock (
+            id        integer primary key check (id = 1),
+            owner     text not null,
+            locked_at text not null
+        );
+    `
+	selectLockQuery = `
+        /* select_schema_migrations_lock */
+        select owner, locked_at from schema_migrations_lock where id = 1;
+    `
+	upsertLockQuery = `
+        /* upsert_schema_migrations_lock */
+        insert into schema_migrations_lock(id, owner, locked_at) values (1, $1, $2)
+        on conflict (id) do update set owner = excluded.owner, locked_at = excluded.locked_at;
+    `
+	refreshLockQuery = `
+        /* refresh_schema_migrations_lock */
+        update schema_migrations_lock set locked_at = $1 where owner = $2;
+    `
+	deleteLockQuery = `
+        /* delete_schema_migrations_lock */
+        delete from schema_migrations_lock where owner = $1;
+    `
+)
+
+// PostgreSQL releases advisory locks of closed sessions itself.
+const (
+	tryAdvisoryLockQuery = `
+        /* try_migrations_advisory_lock */
+        select pg_try_advisory_lock($1);
+    `
+	advisoryLockQuery = `
+        /* migrations_advisory_lock */
+        select pg_advisory_lock($1);
+    `
+	advisoryUnlockQuery = `
+        /* migrations_advisory_unlock */
+        select pg_advisory_unlock($1);
+    `
+)
@@ -0,0 +1,72 @@
+package sqlxutils
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	ErrUniqueViolation      = errors.New("unique constraint violation")
+	ErrForeignKeyViolation  = errors.New("foreign key constraint violation")
+	ErrSerializationFailure = errors.New("serialization failure")
+)
+
+const (
+	pqUniqueViolation      = "23505"
+	pqForeignKeyViolation  = "23503"
+	pqSerializationFailure = "40001"
+	pqDeadlockDetected     = "40P01"
+)
+
+func classifyPostgres(err *pq.Error) error {
+	switch err.Code {
+	case pqUniqueViolation:
+		return ErrUniqueViolation
+	case pqForeignKeyViolation:
+		return ErrForeignKeyViolation
+	case pqSerializationFailure, pqDeadlockDetected:
+		return ErrSerializationFailure
+	default:
+		return nil
+	}
+}
+
+func classifySqlite(err sqlite3.Error) error {
+	switch {
+	case errors.Is(err.ExtendedCode, sqlite3.ErrConstraintUnique), errors.Is(err.ExtendedCode, sqlite3.ErrConstraintPrimaryKey):
+		return ErrUniqueViolation
+	case errors.Is(err.ExtendedCode, sqlite3.ErrConstraintForeignKey):
+		return ErrForeignKeyViolation
+	case errors.Is(err.Code, sqlite3.ErrBusy), errors.Is(err.Code, sqlite3.ErrLocked):
+		return ErrSerializationFailure
+	default:
+		return nil
+	}
+}
+
+// classify marks driver-specific constraint errors with one of the package sentinel errors,
+// so callers can check them with errors.Is regardless of the database engine.
+func classify(err error) error {
+	var kind error
+
+	var (
+		pqErr     *pq.Error
+		sqliteErr sqlite3.Error
+	)
+
+	switch {
+	case errors.As(err, &pqErr):
+		kind = classifyPostgres(pqErr)
+	case errors.As(err, &sqliteErr):
+		kind = classifySqlite(sqliteErr)
+	}
+
+	if kind == nil {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", kind, err)
+}
@@ -0,0 +1,48 @@
+package sqlxutils
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Metrics records query durations labelled by query name and exposes the connection pool stats.
+type Metrics struct {
+	queryDuration *prometheus.HistogramVec
+}
+
+func NewMetrics(registerer prometheus.Registerer, db *sqlx.DB) (*Metrics, error) {
+	queryDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Duration of database queries.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"query", "status"})
+
+	err := registerer.Register(queryDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	err = registerer.Register(collectors.NewDBStatsCollector(db.DB, db.DriverName()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Metrics{queryDuration: queryDuration}, nil
+}
+
+func (m *Metrics) StartQuery(ctx context.Context, name, _ string) (context.Context, func(err error)) {
+	start := time.Now()
+
+	return ctx, func(err error) {
+		status := "ok"
+		if err != nil {
+			status = "error"
+		}
+
+		m.queryDuration.WithLabelValues(name, status).Observe(time.Since(start).Seconds())
+	}
+}
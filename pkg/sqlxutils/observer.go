@@ -0,0 +1,132 @@
+package sqlxutils
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// QueryObserver is notified about every query run through the package functions on a DB or Tx.
+type QueryObserver interface {
+	// StartQuery is called before the query runs. The returned function is called with
+	// the query error, nil if it succeeded or found no rows.
+	StartQuery(ctx context.Context, name, query string) (context.Context, func(err error))
+}
+
+// TxObserver is notified about transactions run with RunTx by the query observers that implement it.
+type TxObserver interface {
+	// StartTx is called before the transaction begins. The returned function is called
+	// with the transaction error once it has been committed or rolled back.
+	StartTx(ctx context.Context) (context.Context, func(err error))
+}
+
+// DB is a sqlx.DB whose queries are reported to observers, including the ones run
+// in transactions started with RunTx.
+type DB struct {
+	*sqlx.DB
+	observers []QueryObserver
+}
+
+func NewDB(db *sqlx.DB, observers ...QueryObserver) *DB {
+	return &DB{
+		DB:        db,
+		observers: observers,
+	}
+}
+
+func (db *DB) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.DB.BeginTxx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{Tx: tx, observers: db.observers}, nil
+}
+
+func (db *DB) queryObservers() []QueryObserver {
+	return db.observers
+}
+
+type Tx struct {
+	*sqlx.Tx
+	observers []QueryObserver
+}
+
+func (tx *Tx) queryObservers() []QueryObserver {
+	return tx.observers
+}
+
+type observed interface {
+	queryObservers() []QueryObserver
+}
+
+const unnamedQuery = "unnamed"
+
+// QueryName returns the name of the query given by its leading "/* <name> */" comment.
+func QueryName(query string) string {
+	comment, found := strings.CutPrefix(strings.TrimSpace(query), "/*")
+	if !found {
+		return unnamedQuery
+	}
+
+	name, _, found := strings.Cut(comment, "*/")
+	name = strings.TrimSpace(name)
+
+	if !found || name == "" {
+		return unnamedQuery
+	}
+
+	return name
+}
+
+func startQuery(ctx context.Context, db any, query string) (context.Context, func(err error)) {
+	o, ok := db.(observed)
+	if !ok || len(o.queryObservers()) == 0 {
+		return ctx, func(error) {}
+	}
+
+	name := QueryName(query)
+	ends := make([]func(err error), 0, len(o.queryObservers()))
+
+	for _, observer := range o.queryObservers() {
+		var end func(err error)
+
+		ctx, end = observer.StartQuery(ctx, name, query)
+		ends = append(ends, end)
+	}
+
+	return ctx, func(err error) {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = nil
+		}
+
+		for i := len(ends) - 1; i >= 0; i-- {
+			ends[i](err)
+		}
+	}
+}
+
+func startTx(ctx context.Context, db *DB) (context.Context, func(err error)) {
+	ends := make([]func(err error), 0, len(db.observers))
+
+	for _, observer := range db.observers {
+		txObserver, ok := observer.(TxObserver)
+		if !ok {
+			continue
+		}
+
+		var end func(err error)
+
+		ctx, end = txObserver.StartTx(ctx)
+		ends = append(ends, end)
+	}
+
+	return ctx, func(err error) {
+		for i := len(ends) - 1; i >= 0; i-- {
+			ends[i](err)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package sqlxutils
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
@@ -10,7 +11,7 @@ import (
 )
 
 func sqlErr(err error, query string, args ...interface{}) error {
-	return errors.Wrapf(err, `run query "%s" with args %+v`, query, args)
+	return errors.Wrapf(classify(err), `run query "%s" with args %+v`, query, args)
 }
 
 func namedQuery(query string, arg interface{}) (nq string, args []interface{}, err error) {
@@ -22,7 +23,10 @@ func namedQuery(query string, arg interface{}) (nq string, args []interface{}, e
 }
 
 func Exec(ctx context.Context, db sqlx.ExecerContext, query string, args ...interface{}) (sql.Result, error) {
+	ctx, end := startQuery(ctx, db, query)
 	res, err := db.ExecContext(ctx, query, args...)
+	end(err)
+
 	if err != nil {
 		return res, sqlErr(err, query, args...)
 	}
@@ -40,7 +44,11 @@ func NamedExec(ctx context.Context, db sqlx.ExtContext, query string, arg interf
 }
 
 func Select(ctx context.Context, db sqlx.QueryerContext, dest interface{}, query string, args ...interface{}) error {
-	if err := sqlx.SelectContext(ctx, db, dest, query, args...); err != nil {
+	ctx, end := startQuery(ctx, db, query)
+	err := sqlx.SelectContext(ctx, db, dest, query, args...)
+	end(err)
+
+	if err != nil {
 		return sqlErr(err, query, args...)
 	}
 
@@ -57,7 +65,11 @@ func NamedSelect(ctx context.Context, db sqlx.ExtContext, dest interface{}, quer
 }
 
 func Get(ctx context.Context, db sqlx.QueryerContext, dest interface{}, query string, args ...interface{}) error {
-	if err := sqlx.GetContext(ctx, db, dest, query, args...); err != nil {
+	ctx, end := startQuery(ctx, db, query)
+	err := sqlx.GetContext(ctx, db, dest, query, args...)
+	end(err)
+
+	if err != nil {
 		return sqlErr(err, query, args...)
 	}
 
@@ -73,14 +85,14 @@ func NamedGet(ctx context.Context, db sqlx.ExtContext, dest interface{}, query s
 	return Get(ctx, db, dest, db.Rebind(nq), args...)
 }
 
-type txFunc func(tx *sqlx.Tx) error
+// txFunc receives the context of the transaction, which queries of the transaction should use.
+type txFunc func(ctx context.Context, tx *Tx) error
 
-type txRunner interface {
-	BeginTxx(context.Context, *sql.TxOptions) (*sqlx.Tx, error)
-}
+func RunTx(ctx context.Context, db *DB, level sql.IsolationLevel, f txFunc) (err error) {
+	ctx, end := startTx(ctx, db)
+	defer func() { end(err) }()
 
-func RunTx(ctx context.Context, db txRunner, level sql.IsolationLevel, f txFunc) (err error) {
-	var tx *sqlx.Tx
+	var tx *Tx
 
 	tx, err = db.BeginTxx(ctx, &sql.TxOptions{Isolation: level})
 	if err != nil {
@@ -95,5 +107,40 @@ func RunTx(ctx context.Context, db txRunner, level sql.IsolationLevel, f txFunc)
 		}
 	}()
 
-	return f(tx)
+	return f(ctx, tx)
+}
+
+// RunSavepoint runs f inside a savepoint of tx, so a failure of f rolls back
+// only its own changes and leaves the rest of the transaction usable.
+func RunSavepoint(ctx context.Context, tx sqlx.ExecerContext, name string, f func() error) error {
+	_, err := Exec(ctx, tx, "/* savepoint */ savepoint "+name)
+	if err != nil {
+		return err
+	}
+
+	err = f()
+	if err != nil {
+		_, rollbackErr := Exec(ctx, tx, "/* rollback_to_savepoint */ rollback to savepoint "+name)
+		return multierr.Combine(err, rollbackErr)
+	}
+
+	_, err = Exec(ctx, tx, "/* release_savepoint */ release savepoint "+name)
+
+	return err
+}
+
+// In expands slice arguments of the query into bindvars and rebinds it for db.
+func In(db sqlx.ExtContext, query string, args ...interface{}) (string, []interface{}, error) {
+	q, inArgs, err := sqlx.In(query, args...)
+	if err != nil {
+		return "", nil, sqlErr(err, query, args...)
+	}
+
+	return db.Rebind(q), inArgs, nil
+}
+
+// Now returns the current time to store in timestamp columns. Stored times are compared with each other,
+// e.g. with a retention boundary, so they are kept in UTC with the same precision on all drivers.
+func Now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
 }
@@ -0,0 +1,58 @@
+package sqlxutils
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing creates a span per query, named after the query and carrying its statement, and per transaction.
+type Tracing struct {
+	tracer trace.Tracer
+	system attribute.KeyValue
+}
+
+func NewTracing(provider trace.TracerProvider, driverName string) *Tracing {
+	system := semconv.DBSystemKey.String(driverName)
+
+	switch driverName {
+	case "sqlite3":
+		system = semconv.DBSystemSqlite
+	case "postgres":
+		system = semconv.DBSystemPostgreSQL
+	}
+
+	return &Tracing{
+		tracer: provider.Tracer("github.com/Inspirate789/grpc-template/pkg/sqlxutils"),
+		system: system,
+	}
+}
+
+func endSpan(span trace.Span) func(err error) {
+	return func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		span.End()
+	}
+}
+
+func (t *Tracing) StartQuery(ctx context.Context, name, query string) (context.Context, func(err error)) {
+	ctx, span := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(t.system, semconv.DBStatement(query)),
+	)
+
+	return ctx, endSpan(span)
+}
+
+func (t *Tracing) StartTx(ctx context.Context) (context.Context, func(err error)) {
+	ctx, span := t.tracer.Start(ctx, "transaction", trace.WithAttributes(t.system))
+
+	return ctx, endSpan(span)
+}
@@ -0,0 +1,36 @@
+import grpc from 'k6/net/grpc';
+import { check, sleep } from 'k6';
+
+export let options = {
+  summaryTrendStats: ["avg", "min", "max", "med", "p(75)", "p(99)"],
+};
+
+const client = new grpc.Client();
+client.load(['../../internal/event/api', '../../third_party'], 'event.proto');
+
+const batchSize = __ENV.BATCH_SIZE ? parseInt(__ENV.BATCH_SIZE) : 100;
+
+export default () => {
+  client.connect('localhost:5050', {
+    plaintext: true
+  });
+
+  const ids = [];
+  for (let i = 0; i < batchSize; i++) {
+    const created = client.invoke('event.EventService/CreateEvent', {name: "eventNew", timestamp: "2025-02-15T20:55:09Z"});
+    if (created && created.status === grpc.StatusOK) {
+      ids.push(created.message.id);
+    }
+  }
+
+  const data = {ids: ids, mode: 'BATCH_MODE_BEST_EFFORT'};
+  const response = client.invoke('event.EventService/BatchDeleteEvents', data);
+
+  check(response, {
+    'status is OK': (r) => r && r.status === grpc.StatusOK,
+    'all events deleted': (r) => r && r.message.results.every((result) => !result.status.code),
+  });
+
+  client.close();
+  sleep(1);
+};
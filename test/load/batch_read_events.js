@@ -0,0 +1,32 @@
+import grpc from 'k6/net/grpc';
+import { check, sleep } from 'k6';
+
+export let options = {
+  summaryTrendStats: ["avg", "min", "max", "med", "p(75)", "p(99)"],
+};
+
+const client = new grpc.Client();
+client.load(['../../internal/event/api', '../../third_party'], 'event.proto');
+
+const batchSize = __ENV.BATCH_SIZE ? parseInt(__ENV.BATCH_SIZE) : 100;
+
+export default () => {
+  client.connect('localhost:5050', {
+    plaintext: true
+  });
+
+  const ids = [];
+  for (let i = 1; i <= batchSize; i++) {
+    ids.push(i);
+  }
+
+  const data = {ids: ids};
+  const response = client.invoke('event.EventService/BatchGetEvents', data);
+
+  check(response, {
+    'status is OK': (r) => r && r.status === grpc.StatusOK,
+  });
+
+  client.close();
+  sleep(1);
+};
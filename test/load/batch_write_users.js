@@ -0,0 +1,34 @@
+import grpc from 'k6/net/grpc';
+import { check, sleep } from 'k6';
+
+export let options = {
+  summaryTrendStats: ["avg", "min", "max", "med", "p(75)", "p(99)"],
+};
+
+const client = new grpc.Client();
+client.load(['../../internal/user/api', '../../third_party'], 'user.proto');
+
+const batchSize = __ENV.BATCH_SIZE ? parseInt(__ENV.BATCH_SIZE) : 100;
+const mode = __ENV.BATCH_MODE || 'BATCH_MODE_ATOMIC';
+
+export default () => {
+  client.connect('localhost:5050', {
+    plaintext: true
+  });
+
+  const users = [];
+  for (let i = 0; i < batchSize; i++) {
+    users.push({name: `user${__VU}_${__ITER}_${i}`});
+  }
+
+  const data = {users: users, mode: mode};
+  const response = client.invoke('user.UserService/BatchCreateUsers', data);
+
+  check(response, {
+    'status is OK': (r) => r && r.status === grpc.StatusOK,
+    'all users created': (r) => r && r.message.results.every((result) => !result.status.code),
+  });
+
+  client.close();
+  sleep(1);
+};
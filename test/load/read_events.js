@@ -6,7 +6,7 @@ export let options = {
 };
 
 const client = new grpc.Client();
-client.load(['../../internal/event/api'], 'event.proto');
+client.load(['../../internal/event/api', '../../third_party'], 'event.proto');
 
 export default () => {
   client.connect('localhost:5050', {